@@ -0,0 +1,118 @@
+// Command reconcile-media compares the assets in media storage with the media
+// referenced from the database and reports orphaned files that no post uses.
+//
+//	go run ./cmd/reconcile-media [-prefix posts/] [-grace 24h] [-delete]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"mentorship-backend/config"
+	"mentorship-backend/models"
+	"mentorship-backend/utils"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	prefix := flag.String("prefix", "posts/", "only consider assets whose public ID starts with this prefix")
+	grace := flag.Duration("grace", 24*time.Hour, "ignore assets younger than this, they may belong to uploads in progress")
+	deleteOrphans := flag.Bool("delete", false, "queue orphaned assets for deletion instead of only reporting them")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Printf("Warning: .env file not found: %v", err)
+	}
+
+	config.InitializeDatabase()
+	if err := utils.InitMediaStore(); err != nil {
+		log.Fatal("Error initializing media storage:", err)
+	}
+
+	assets, err := utils.GetMediaStore().List(context.Background(), *prefix)
+	if err != nil {
+		log.Fatal("Error listing stored media:", err)
+	}
+
+	referenced, err := referencedPublicIDs()
+	if err != nil {
+		log.Fatal("Error loading referenced media:", err)
+	}
+
+	cutoff := time.Now().Add(-*grace)
+	var orphans []utils.StoredAsset
+	var orphanBytes int64
+	for _, asset := range assets {
+		if referenced[asset.PublicID] || asset.CreatedAt.After(cutoff) {
+			continue
+		}
+		orphans = append(orphans, asset)
+		orphanBytes += asset.Bytes
+		fmt.Printf("%s\t%s\t%d\t%s\n", asset.PublicID, asset.ResourceType, asset.Bytes, asset.CreatedAt.Format(time.RFC3339))
+	}
+
+	log.Printf("Checked %d stored assets, found %d orphans using %d bytes", len(assets), len(orphans), orphanBytes)
+
+	if *deleteOrphans && len(orphans) > 0 {
+		deletions := make([]models.MediaDeletion, len(orphans))
+		for i, asset := range orphans {
+			deletions[i] = models.MediaDeletion{PublicID: asset.PublicID, ResourceType: asset.ResourceType}
+		}
+		if err := config.GetDB().CreateInBatches(&deletions, 100).Error; err != nil {
+			log.Fatal("Error queueing orphaned media for deletion:", err)
+		}
+		log.Printf("Queued %d orphaned assets for deletion", len(orphans))
+	}
+}
+
+// referencedPublicIDs returns the public IDs still in use by posts and avatars, including pending uploads
+// and assets already queued for deletion
+func referencedPublicIDs() (map[string]bool, error) {
+	db := config.GetDB()
+	referenced := make(map[string]bool)
+
+	var media []models.PostMedia
+	if err := db.Select("url", "public_id").Find(&media).Error; err != nil {
+		return nil, err
+	}
+	for _, item := range media {
+		publicID := item.PublicID
+		if publicID == "" {
+			publicID, _, _ = utils.PublicIDFromURL(item.URL)
+		}
+		referenced[publicID] = true
+	}
+
+	var users []models.User
+	if err := db.Select("avatar_public_id", "avatar_thumbnails").Where("avatar_public_id <> ''").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		referenced[user.AvatarPublicID] = true
+		for _, thumbnail := range user.AvatarThumbnails {
+			referenced[thumbnail.PublicID] = true
+		}
+	}
+
+	// Signed uploads that may still be completed
+	var pending []string
+	if err := db.Model(&models.PendingUpload{}).Where("status = ?", models.PendingUploadPending).Pluck("public_id", &pending).Error; err != nil {
+		return nil, err
+	}
+	for _, publicID := range pending {
+		referenced[publicID] = true
+	}
+
+	var queued []string
+	if err := db.Model(&models.MediaDeletion{}).Pluck("public_id", &queued).Error; err != nil {
+		return nil, err
+	}
+	for _, publicID := range queued {
+		referenced[publicID] = true
+	}
+
+	return referenced, nil
+}
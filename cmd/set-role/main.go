@@ -0,0 +1,42 @@
+// Command set-role changes the role of a user, e.g. to let them review quarantined
+// media as a moderator.
+//
+//	go run ./cmd/set-role -email ana@example.com -role moderator
+package main
+
+import (
+	"flag"
+	"log"
+	"mentorship-backend/config"
+	"mentorship-backend/models"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	email := flag.String("email", "", "email of the user whose role is changed")
+	role := flag.String("role", string(models.RoleModerator), "role to give the user: user or moderator")
+	flag.Parse()
+
+	if *email == "" {
+		log.Fatal("The -email flag is required")
+	}
+	if !models.IsValidRole(models.Role(*role)) {
+		log.Fatalf("Unknown role %q", *role)
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Printf("Warning: .env file not found: %v", err)
+	}
+
+	config.InitializeDatabase()
+
+	result := config.GetDB().Model(&models.User{}).Where("email = ?", *email).Update("role", *role)
+	if result.Error != nil {
+		log.Fatal("Error updating the role:", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		log.Fatalf("No user with email %s", *email)
+	}
+	log.Printf("%s is now a %s", *email, *role)
+}
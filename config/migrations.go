@@ -0,0 +1,319 @@
+package config
+
+import "log"
+
+// dataMigrations are idempotent statements run once, after AutoMigrate, to backfill
+// or repair data that the schema changes alone cannot express.
+var dataMigrations = []struct {
+	name string
+	sql  string
+}{
+	{
+		name: "backfill posts.published_at",
+		sql:  "UPDATE posts SET published_at = created_at WHERE status = 'published' AND published_at IS NULL",
+	},
+	{
+		// Private posts were only ever shown to their author
+		name: "replace posts.is_private with visibility",
+		sql: `DO $$
+BEGIN
+	IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'posts' AND column_name = 'is_private') THEN
+		UPDATE posts SET visibility = 'only_me' WHERE is_private = true;
+		ALTER TABLE posts DROP COLUMN is_private;
+	END IF;
+END $$`,
+	},
+	{
+		name: "move posts.media_urls into post_media",
+		sql: `DO $$
+BEGIN
+	IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'posts' AND column_name = 'media_urls') THEN
+		INSERT INTO post_media (id, post_id, type, url, position, created_at, updated_at)
+		SELECT gen_random_uuid(), posts.id, 'image', media.url, media.position - 1, posts.created_at, posts.created_at
+		FROM posts, unnest(posts.media_urls) WITH ORDINALITY AS media(url, position)
+		WHERE media.url <> '';
+		ALTER TABLE posts DROP COLUMN media_urls;
+	END IF;
+END $$`,
+	},
+	{
+		// Media uploaded before public IDs were stored only has its Cloudinary URL
+		name: "backfill post_media public IDs",
+		sql: `UPDATE post_media SET
+	public_id = regexp_replace(regexp_replace(url, '^.*/(image|video|raw)/upload/(v[0-9]+/)?', ''), '\.[^./]+$', ''),
+	resource_type = substring(url from '/(image|video|raw)/upload/')
+WHERE (public_id IS NULL OR public_id = '') AND url LIKE '%/upload/%'`,
+	},
+	{
+		name: "backfill post_media resource types",
+		sql:  "UPDATE post_media SET resource_type = type WHERE resource_type IS NULL OR resource_type = ''",
+	},
+	{
+		// Follows each share up its chain, however long, to the post that is not a share
+		name: "collapse share chains to the root original",
+		sql: `WITH RECURSIVE chain (id, root, depth) AS (
+	SELECT id, original_post_id, 1 FROM posts WHERE original_post_id IS NOT NULL
+	UNION ALL
+	SELECT chain.id, parent.original_post_id, chain.depth + 1
+	FROM chain JOIN posts parent ON parent.id = chain.root
+	WHERE parent.original_post_id IS NOT NULL AND chain.depth < 100
+)
+UPDATE posts SET original_post_id = chain.root
+FROM chain JOIN posts root ON root.id = chain.root
+WHERE posts.id = chain.id AND root.original_post_id IS NULL
+AND posts.original_post_id <> chain.root`,
+	},
+	{
+		name: "remove duplicate plain reshares",
+		sql: `UPDATE posts SET deleted_at = NOW()
+WHERE original_post_id IS NOT NULL AND is_quote = false AND deleted_at IS NULL
+AND EXISTS (
+	SELECT 1 FROM posts earlier
+	WHERE earlier.user_id = posts.user_id AND earlier.original_post_id = posts.original_post_id
+	AND earlier.is_quote = false AND earlier.deleted_at IS NULL
+	AND (earlier.created_at, earlier.id) < (posts.created_at, posts.id)
+)`,
+	},
+	{
+		name: "unique plain reshare per user",
+		sql: `CREATE UNIQUE INDEX IF NOT EXISTS idx_posts_unique_reshare ON posts (user_id, original_post_id)
+WHERE original_post_id IS NOT NULL AND is_quote = false AND deleted_at IS NULL`,
+	},
+	{
+		name: "recount post shares",
+		sql: `UPDATE posts SET analytics__shares = counts.shares
+FROM (
+	SELECT original.id, COUNT(shares.id) AS shares
+	FROM posts original
+	LEFT JOIN posts shares ON shares.original_post_id = original.id AND shares.deleted_at IS NULL
+	GROUP BY original.id
+) counts
+WHERE counts.id = posts.id AND posts.analytics__shares <> counts.shares`,
+	},
+	{
+		name: "recount post saves",
+		sql: `UPDATE posts SET analytics__saved_count = counts.saves
+FROM (
+	SELECT posts.id, COUNT(user_saved_posts.post_id) AS saves
+	FROM posts
+	LEFT JOIN user_saved_posts ON user_saved_posts.post_id = posts.id
+	GROUP BY posts.id
+) counts
+WHERE counts.id = posts.id AND posts.analytics__saved_count <> counts.saves`,
+	},
+	{
+		name: "backfill comments.depth",
+		sql: `WITH RECURSIVE tree AS (
+	SELECT id, 0 AS depth FROM comments WHERE parent_id IS NULL
+	UNION ALL
+	SELECT comments.id, tree.depth + 1 FROM comments JOIN tree ON comments.parent_id = tree.id
+)
+UPDATE comments SET depth = tree.depth
+FROM tree
+WHERE tree.id = comments.id AND comments.depth <> tree.depth`,
+	},
+	{
+		name: "recount comment replies",
+		sql: `UPDATE comments SET reply_count = counts.replies
+FROM (
+	SELECT parent.id, COUNT(replies.id) AS replies
+	FROM comments parent
+	LEFT JOIN comments replies ON replies.parent_id = parent.id AND replies.deleted_at IS NULL
+	GROUP BY parent.id
+) counts
+WHERE counts.id = comments.id AND comments.reply_count <> counts.replies`,
+	},
+	{
+		// Deleted comments and tombstones do not count
+		name: "recount post comments",
+		sql: `UPDATE posts SET analytics__comment_count = counts.comments
+FROM (
+	SELECT posts.id, COUNT(comments.id) AS comments
+	FROM posts
+	LEFT JOIN comments ON comments.post_id = posts.id AND comments.deleted_at IS NULL AND comments.tombstoned_at IS NULL
+	GROUP BY posts.id
+) counts
+WHERE counts.id = posts.id AND posts.analytics__comment_count <> counts.comments`,
+	},
+	{
+		name: "recount comment reactions",
+		sql: `UPDATE comments SET likes = counts.reactions
+FROM (
+	SELECT comments.id, COUNT(comment_reactions.user_id) AS reactions
+	FROM comments
+	LEFT JOIN comment_reactions ON comment_reactions.comment_id = comments.id
+	GROUP BY comments.id
+) counts
+WHERE counts.id = comments.id AND comments.likes <> counts.reactions`,
+	},
+	{
+		// Users from before usernames get one derived from their name, made unique by their ID
+		name: "backfill users.username",
+		sql: `UPDATE users SET username = left(COALESCE(NULLIF(lower(regexp_replace(name, '[^A-Za-z0-9_]', '', 'g')), ''), 'user'), 20)
+	|| '_' || left(replace(id::text, '-', ''), 8)
+WHERE username IS NULL OR username = ''`,
+	},
+	{
+		name: "unique usernames",
+		sql:  "CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (lower(username)) WHERE username <> ''",
+	},
+	{
+		// Concurrent follows could add the same follow twice, keep the first
+		name: "remove duplicate follows",
+		sql: `UPDATE follows SET deleted_at = NOW()
+WHERE deleted_at IS NULL
+AND EXISTS (
+	SELECT 1 FROM follows earlier
+	WHERE earlier.follower_id = follows.follower_id AND earlier.following_id = follows.following_id
+	AND earlier.deleted_at IS NULL
+	AND (earlier.created_at, earlier.id) < (follows.created_at, follows.id)
+)`,
+	},
+	{
+		name: "unique follow per pair",
+		sql: `CREATE UNIQUE INDEX IF NOT EXISTS idx_follows_pair ON follows (follower_id, following_id)
+WHERE deleted_at IS NULL`,
+	},
+	{
+		name: "recount user follows",
+		sql: `UPDATE users SET follower_count = counts.followers, following_count = counts.following
+FROM (
+	SELECT users.id,
+		(SELECT COUNT(*) FROM follows WHERE follows.following_id = users.id AND follows.deleted_at IS NULL) AS followers,
+		(SELECT COUNT(*) FROM follows WHERE follows.follower_id = users.id AND follows.deleted_at IS NULL) AS following
+	FROM users
+) counts
+WHERE counts.id = users.id AND (users.follower_count <> counts.followers OR users.following_count <> counts.following)`,
+	},
+	{
+		name: "recount user posts",
+		sql: `UPDATE users SET post_count = counts.posts
+FROM (
+	SELECT users.id, COUNT(posts.id) AS posts
+	FROM users
+	LEFT JOIN posts ON posts.user_id = users.id AND posts.status = 'published' AND posts.deleted_at IS NULL
+	GROUP BY users.id
+) counts
+WHERE counts.id = users.id AND users.post_count <> counts.posts`,
+	},
+	{
+		// Concurrent likes could add the same like twice, keep the first
+		name: "remove duplicate likes",
+		sql: `UPDATE likes SET deleted_at = NOW()
+WHERE deleted_at IS NULL
+AND EXISTS (
+	SELECT 1 FROM likes earlier
+	WHERE earlier.post_id = likes.post_id AND earlier.user_id = likes.user_id
+	AND earlier.deleted_at IS NULL
+	AND (earlier.created_at, earlier.id) < (likes.created_at, likes.id)
+)`,
+	},
+	{
+		name: "unique like per user",
+		sql: `CREATE UNIQUE INDEX IF NOT EXISTS idx_likes_pair ON likes (post_id, user_id)
+WHERE deleted_at IS NULL`,
+	},
+	{
+		name: "recount post likes",
+		sql: `UPDATE posts SET analytics__likes = counts.likes
+FROM (
+	SELECT posts.id, COUNT(likes.id) AS likes
+	FROM posts
+	LEFT JOIN likes ON likes.post_id = posts.id AND likes.deleted_at IS NULL
+	GROUP BY posts.id
+) counts
+WHERE counts.id = posts.id AND posts.analytics__likes <> counts.likes`,
+	},
+	{
+		// Announces notification changes to every instance, see realtime.Listen. Only
+		// committed changes are delivered.
+		name: "notification events function",
+		sql: `CREATE OR REPLACE FUNCTION notify_notification_event() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'INSERT' THEN
+		PERFORM pg_notify('notification_events', json_build_object('type', 'created', 'userId', NEW.user_id, 'notificationId', NEW.id)::text);
+	ELSIF TG_OP = 'UPDATE' AND OLD.actor_count IS DISTINCT FROM NEW.actor_count THEN
+		PERFORM pg_notify('notification_events', json_build_object('type', 'created', 'userId', NEW.user_id, 'notificationId', NEW.id)::text);
+	ELSIF TG_OP = 'DELETE' THEN
+		PERFORM pg_notify('notification_events', json_build_object('type', 'changed', 'userId', OLD.user_id)::text);
+	ELSIF OLD.is_read IS DISTINCT FROM NEW.is_read OR OLD.deleted_at IS DISTINCT FROM NEW.deleted_at THEN
+		PERFORM pg_notify('notification_events', json_build_object('type', 'changed', 'userId', NEW.user_id)::text);
+	END IF;
+	RETURN NULL;
+END $$ LANGUAGE plpgsql`,
+	},
+	{
+		name: "notification events trigger",
+		sql: `DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'notifications_notify_event') THEN
+		CREATE TRIGGER notifications_notify_event AFTER INSERT OR UPDATE OR DELETE ON notifications
+		FOR EACH ROW EXECUTE PROCEDURE notify_notification_event();
+	END IF;
+END $$`,
+	},
+	{
+		// Deleting a notification removes the actors grouped into it
+		name: "cascade notification actors",
+		sql: `DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_notification_actors_notification') THEN
+		DELETE FROM notification_actors WHERE NOT EXISTS (SELECT 1 FROM notifications WHERE notifications.id = notification_actors.notification_id);
+		ALTER TABLE notification_actors ADD CONSTRAINT fk_notification_actors_notification
+			FOREIGN KEY (notification_id) REFERENCES notifications (id) ON DELETE CASCADE;
+	END IF;
+END $$`,
+	},
+}
+
+// dataMigrationsLock is the advisory lock key that keeps instances booting at the
+// same time from applying a migration twice
+const dataMigrationsLock = 7243016
+
+// RunDataMigrations applies the data migrations that have not been applied yet, in
+// order. Applied migrations are recorded by name in the data_migrations table, so
+// changing one that already ran has no effect; add a new one instead.
+func RunDataMigrations() {
+	if err := db.Exec(`CREATE TABLE IF NOT EXISTS data_migrations (
+	name text PRIMARY KEY,
+	applied_at timestamptz NOT NULL DEFAULT now()
+)`).Error; err != nil {
+		log.Fatalf("Creating the data migrations table failed: %v", err)
+	}
+
+	for _, migration := range dataMigrations {
+		if err := applyDataMigration(migration.name, migration.sql); err != nil {
+			log.Fatalf("Data migration %q failed: %v", migration.name, err)
+		}
+	}
+}
+
+// applyDataMigration runs a migration and records it in one transaction, unless it
+// has been applied before
+func applyDataMigration(name string, sql string) error {
+	tx := db.Begin()
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", dataMigrationsLock).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var applied int64
+	if err := tx.Table("data_migrations").Where("name = ?", name).Count(&applied).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if applied > 0 {
+		tx.Rollback()
+		return nil
+	}
+
+	if err := tx.Exec(sql).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Exec("INSERT INTO data_migrations (name) VALUES (?)", name).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
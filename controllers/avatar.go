@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mentorship-backend/config"
+	"mentorship-backend/models"
+	"mentorship-backend/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+)
+
+// UploadAvatar replaces the user's avatar with an uploaded image, cropped to a
+// square and stored in every avatar size. The previous avatar is deleted.
+func (uc *UserController) UploadAvatar(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	file, err := c.FormFile("avatar")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No avatar uploaded"})
+		return
+	}
+
+	info, err := utils.InspectMedia(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if info.Type != models.MediaTypeImage {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Avatar must be an image"})
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read avatar"})
+		return
+	}
+	defer src.Close()
+
+	user, status, err := replaceAvatar(c.Request.Context(), userID.(uuid.UUID), src, info)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, avatarResponse(user))
+}
+
+// replaceAvatar scans and processes an avatar image, stores its sizes and swaps
+// them in for the user's current avatar, whose files are queued for deletion.
+// It returns the HTTP status to respond with when it fails.
+func replaceAvatar(ctx context.Context, userID uuid.UUID, src io.Reader, info *utils.MediaInfo) (*models.User, int, error) {
+	scan, err := utils.GetMediaScanner().Scan(ctx, src, info)
+	if errors.Is(err, utils.ErrMediaRejected) {
+		return nil, http.StatusBadRequest, err
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to scan avatar")
+	}
+	// Avatars are shown everywhere right away, so they cannot wait in quarantine
+	if scan.Flagged {
+		return nil, http.StatusBadRequest, fmt.Errorf("avatar was flagged for review: %s", scan.Reason)
+	}
+
+	images, err := utils.ProcessAvatar(scan.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	// Store every size before touching the user, so a failed upload leaves the old avatar in place
+	var stored []utils.StoredAsset
+	thumbnails := make([]models.AvatarThumbnail, 0, len(images))
+	for _, img := range images {
+		result, err := utils.GetMediaStore().Upload(ctx, bytes.NewReader(img.Data), utils.UploadOptions{
+			Folder:       "avatars",
+			ResourceType: models.MediaTypeImage,
+			MimeType:     "image/jpeg",
+		})
+		if err != nil {
+			go discardStoredAssets(stored)
+			return nil, http.StatusInternalServerError, fmt.Errorf("failed to upload avatar")
+		}
+		stored = append(stored, utils.StoredAsset{PublicID: result.PublicID, ResourceType: result.ResourceType})
+		thumbnails = append(thumbnails, models.AvatarThumbnail{Size: img.Size, URL: result.URL, PublicID: result.PublicID})
+	}
+
+	tx := config.GetDB().Begin()
+
+	var user models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, "id = ?", userID).Error; err != nil {
+		tx.Rollback()
+		go discardStoredAssets(stored)
+		return nil, http.StatusNotFound, fmt.Errorf("user not found")
+	}
+	previous := avatarAssets(&user)
+
+	// The largest size is the avatar itself, the rest are its thumbnails
+	user.AvatarURL = thumbnails[0].URL
+	user.AvatarPublicID = thumbnails[0].PublicID
+	user.AvatarThumbnails = thumbnails[1:]
+	if err := tx.Model(&user).Select("AvatarURL", "AvatarPublicID", "AvatarThumbnails").Updates(&user).Error; err != nil {
+		tx.Rollback()
+		go discardStoredAssets(stored)
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to update avatar")
+	}
+	if err := enqueueMediaDeletion(tx, previous); err != nil {
+		tx.Rollback()
+		go discardStoredAssets(stored)
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to update avatar")
+	}
+	if err := tx.Commit().Error; err != nil {
+		go discardStoredAssets(stored)
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to update avatar")
+	}
+
+	go processMediaDeletionsNow()
+	return &user, http.StatusOK, nil
+}
+
+// avatarAssets lists the stored files of a user's avatar and its thumbnails
+func avatarAssets(user *models.User) []utils.StoredAsset {
+	var assets []utils.StoredAsset
+	if user.AvatarPublicID != "" {
+		assets = append(assets, utils.StoredAsset{PublicID: user.AvatarPublicID, ResourceType: models.MediaTypeImage})
+	}
+	for _, thumbnail := range user.AvatarThumbnails {
+		assets = append(assets, utils.StoredAsset{PublicID: thumbnail.PublicID, ResourceType: models.MediaTypeImage})
+	}
+	return assets
+}
+
+// avatarResponse describes a user's avatar and its thumbnails keyed by size
+func avatarResponse(user *models.User) gin.H {
+	thumbnails := make(map[string]string, len(user.AvatarThumbnails))
+	for _, thumbnail := range user.AvatarThumbnails {
+		thumbnails[fmt.Sprint(thumbnail.Size)] = thumbnail.URL
+	}
+	return gin.H{
+		"avatarUrl":  user.AvatarURL,
+		"thumbnails": thumbnails,
+	}
+}
@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"mentorship-backend/config"
+	"mentorship-backend/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+)
+
+type BlockController struct{}
+
+func NewBlockController() *BlockController {
+	return &BlockController{}
+}
+
+// BlockUser blocks a user. Follows, mentorships and requests for either between the
+// two users are removed, and each stops seeing the other's profile, posts, comments and likes.
+func (bc *BlockController) BlockUser(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	target, ok := findOtherUser(c, userID.(uuid.UUID))
+	if !ok {
+		return
+	}
+
+	tx := config.GetDB().Begin()
+	block := models.Block{BlockerID: userID.(uuid.UUID), BlockedID: target.ID}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&block).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to block user"})
+		return
+	}
+
+	pair := []uuid.UUID{block.BlockerID, block.BlockedID}
+	var follows []models.Follow
+	if err := tx.Where("follower_id IN ? AND following_id IN ?", pair, pair).Find(&follows).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove follows"})
+		return
+	}
+	for i := range follows {
+		if err := tx.Delete(&follows[i]).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove follows"})
+			return
+		}
+		if err := adjustFollowCounts(tx, follows[i].FollowerID, follows[i].FollowingID, -1); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update follow counts"})
+			return
+		}
+	}
+	if err := tx.Where("requester_id IN ? AND target_id IN ?", pair, pair).Delete(&models.FollowRequest{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove follow requests"})
+		return
+	}
+	if err := tx.Where("mentor_id IN ? AND mentee_id IN ?", pair, pair).Delete(&models.Mentorship{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove mentorships"})
+		return
+	}
+	if err := tx.Where("mentor_id IN ? AND mentee_id IN ?", pair, pair).Delete(&models.MentorshipRequest{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove mentorship requests"})
+		return
+	}
+
+	tx.Commit()
+	c.JSON(http.StatusOK, gin.H{"message": "User blocked", "blocked": true})
+}
+
+// UnblockUser removes a block. Follows removed by the block are not restored.
+func (bc *BlockController) UnblockUser(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	result := config.GetDB().Where("blocker_id = ? AND blocked_id = ?", userID, c.Param("id")).Delete(&models.Block{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unblock user"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not blocked"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unblocked", "blocked": false})
+}
+
+// ListBlocks lists the users the current user has blocked, most recent first
+func (bc *BlockController) ListBlocks(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	query := config.GetDB().Model(&models.Block{}).Where("blocker_id = ?", userID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch blocked users"})
+		return
+	}
+
+	page := getPagination(c)
+	var blocks []models.Block
+	if err := query.Preload("Blocked").Order("created_at DESC").Scopes(page.scope).Find(&blocks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch blocked users"})
+		return
+	}
+
+	users := make([]gin.H, len(blocks))
+	for i, block := range blocks {
+		users[i] = gin.H{
+			"id":        block.Blocked.ID,
+			"name":      block.Blocked.Name,
+			"username":  block.Blocked.Username,
+			"avatarURL": block.Blocked.AvatarURL,
+			"blockedAt": block.CreatedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users": users,
+		"page":  page.Page,
+		"limit": page.Limit,
+		"total": total,
+	})
+}
+
+// MuteUser hides a user's posts from the current user's feed and their actions
+// from the current user's notifications
+func (bc *BlockController) MuteUser(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	target, ok := findOtherUser(c, userID.(uuid.UUID))
+	if !ok {
+		return
+	}
+
+	mute := models.Mute{MuterID: userID.(uuid.UUID), MutedID: target.ID}
+	if err := config.GetDB().Clauses(clause.OnConflict{DoNothing: true}).Create(&mute).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mute user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User muted", "muted": true})
+}
+
+// UnmuteUser removes a mute
+func (bc *BlockController) UnmuteUser(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	result := config.GetDB().Where("muter_id = ? AND muted_id = ?", userID, c.Param("id")).Delete(&models.Mute{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unmute user"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not muted"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unmuted", "muted": false})
+}
+
+// ListMutes lists the users the current user has muted, most recent first
+func (bc *BlockController) ListMutes(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	query := config.GetDB().Model(&models.Mute{}).Where("muter_id = ?", userID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch muted users"})
+		return
+	}
+
+	page := getPagination(c)
+	var mutes []models.Mute
+	if err := query.Preload("Muted").Order("created_at DESC").Scopes(page.scope).Find(&mutes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch muted users"})
+		return
+	}
+
+	users := make([]gin.H, len(mutes))
+	for i, mute := range mutes {
+		users[i] = gin.H{
+			"id":        mute.Muted.ID,
+			"name":      mute.Muted.Name,
+			"username":  mute.Muted.Username,
+			"avatarURL": mute.Muted.AvatarURL,
+			"mutedAt":   mute.CreatedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users": users,
+		"page":  page.Page,
+		"limit": page.Limit,
+		"total": total,
+	})
+}
+
+// findOtherUser loads the user named by the id parameter, writing an error
+// response if it is missing or is the current user
+func findOtherUser(c *gin.Context, userID uuid.UUID) (*models.User, bool) {
+	targetID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+	if targetID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot block or mute yourself"})
+		return nil, false
+	}
+
+	var target models.User
+	if err := config.GetDB().First(&target, "id = ?", targetID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &target, true
+}
@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"mentorship-backend/config"
+	"mentorship-backend/models"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type BookmarkController struct{}
+
+func NewBookmarkController() *BookmarkController {
+	return &BookmarkController{}
+}
+
+type collectionRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// ListCollections lists the user's bookmark collections with the number of saved posts in each
+func (bc *BookmarkController) ListCollections(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var collections []struct {
+		models.BookmarkCollection
+		PostsCount int64 `json:"postsCount"`
+	}
+	if err := config.GetDB().Model(&models.BookmarkCollection{}).
+		Select("bookmark_collections.*, COUNT(user_saved_posts.post_id) AS posts_count").
+		Joins("LEFT JOIN user_saved_posts ON user_saved_posts.collection_id = bookmark_collections.id").
+		Where("bookmark_collections.user_id = ?", userID).
+		Group("bookmark_collections.id").
+		Order("bookmark_collections.name ASC").
+		Scan(&collections).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch collections"})
+		return
+	}
+
+	c.JSON(http.StatusOK, collections)
+}
+
+// CreateCollection creates a new bookmark collection
+func (bc *BookmarkController) CreateCollection(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req collectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Collection name is required"})
+		return
+	}
+
+	var existing models.BookmarkCollection
+	if err := config.GetDB().Where("user_id = ? AND name = ?", userID, name).First(&existing).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "A collection with this name already exists"})
+		return
+	}
+
+	collection := models.BookmarkCollection{
+		UserID: userID.(uuid.UUID),
+		Name:   name,
+	}
+	if err := config.GetDB().Create(&collection).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create collection"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, collection)
+}
+
+// RenameCollection renames one of the user's bookmark collections
+func (bc *BookmarkController) RenameCollection(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req collectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Collection name is required"})
+		return
+	}
+
+	var collection models.BookmarkCollection
+	if err := config.GetDB().First(&collection, "id = ? AND user_id = ?", c.Param("id"), userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		return
+	}
+
+	var existing models.BookmarkCollection
+	if err := config.GetDB().Where("user_id = ? AND name = ? AND id <> ?", userID, name, collection.ID).First(&existing).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "A collection with this name already exists"})
+		return
+	}
+
+	collection.Name = name
+	if err := config.GetDB().Save(&collection).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename collection"})
+		return
+	}
+
+	c.JSON(http.StatusOK, collection)
+}
+
+// DeleteCollection deletes a bookmark collection. Its posts stay saved, uncategorized.
+func (bc *BookmarkController) DeleteCollection(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var collection models.BookmarkCollection
+	if err := config.GetDB().First(&collection, "id = ? AND user_id = ?", c.Param("id"), userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		return
+	}
+
+	tx := config.GetDB().Begin()
+	if err := tx.Model(&models.SavedPost{}).
+		Where("collection_id = ?", collection.ID).
+		Update("collection_id", nil).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update saved posts"})
+		return
+	}
+
+	if err := tx.Delete(&collection).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete collection"})
+		return
+	}
+
+	tx.Commit()
+	c.JSON(http.StatusOK, gin.H{"message": "Collection deleted successfully"})
+}
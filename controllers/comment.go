@@ -1,13 +1,17 @@
 package controllers
 
 import (
+	"errors"
 	"mentorship-backend/config"
+	"mentorship-backend/events"
 	"mentorship-backend/models"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type CommentController struct{}
@@ -16,7 +20,13 @@ func NewCommentController() *CommentController {
 	return &CommentController{}
 }
 
-// CreateComment creates a new comment
+// commentRequest is the body of CreateComment and ReplyToComment
+type commentRequest struct {
+	Content  string `json:"content" binding:"required"`
+	ParentID string `json:"parentId"` // Optional comment on the same post to reply to
+}
+
+// CreateComment creates a new comment, or a reply when parentId is given
 func (cc *CommentController) CreateComment(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -24,56 +34,114 @@ func (cc *CommentController) CreateComment(c *gin.Context) {
 		return
 	}
 
-	postID := c.Param("id")
-	var comment models.Comment
-	if err := c.ShouldBindJSON(&comment); err != nil {
+	var req commentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	comment.UserID = userID.(uuid.UUID)
-	postUUID, err := uuid.Parse(postID)
+	postUUID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
 		return
 	}
-	comment.PostID = postUUID
 
-	tx := config.GetDB().Begin()
-	if err := tx.Create(&comment).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
+	var post models.Post
+	if err := config.GetDB().First(&post, "id = ?", postUUID).Error; err != nil || !canViewPost(config.GetDB(), &post, viewerID(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
 		return
 	}
 
-	// Increment comment count
-	if err := tx.Model(&models.Post{}).Where("id = ?", postID).
-		UpdateColumn("analytics__comment_count", gorm.Expr("analytics__comment_count + ?", 1)).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment count"})
+	var parent *models.Comment
+	if req.ParentID != "" {
+		parent = &models.Comment{}
+		if err := config.GetDB().First(parent, "id = ? AND post_id = ?", req.ParentID, post.ID).Error; err != nil || parent.IsTombstone() ||
+			isBlocked(config.GetDB(), viewerID(c), parent.UserID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parent comment not found on this post"})
+			return
+		}
+	}
+
+	comment := models.Comment{
+		PostID:  post.ID,
+		UserID:  userID.(uuid.UUID),
+		Content: req.Content,
+	}
+	if err := createComment(&post, &comment, parent); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parent comment not found on this post"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
 		return
 	}
 
-	tx.Commit()
+	linkCommentMentions(config.GetDB(), &comment)
 	c.JSON(http.StatusCreated, comment)
 }
 
-// GetComments gets all comments for a post
+// GetComments gets a page of a post's top-level comments with their reply threads.
+// Query parameters: sort (newest, oldest or top), limit, cursor, depth and replies.
+// The cursor of the next page, if any, is sent in X-Next-Cursor.
 func (cc *CommentController) GetComments(c *gin.Context) {
 	postID := c.Param("id")
-	
-	var comments []models.Comment
-	if err := config.GetDB().Where("post_id = ? AND parent_id IS NULL", postID).
-		Preload("User").
-		Preload("Replies.User").
-		Find(&comments).Error; err != nil {
+
+	var post models.Post
+	if err := config.GetDB().First(&post, "id = ?", postID).Error; err != nil || !canViewPost(config.GetDB(), &post, viewerID(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	opts, err := getThreadOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := config.GetDB().Where("post_id = ? AND parent_id IS NULL", post.ID)
+	comments, nextCursor, err := loadCommentPage(query, opts)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch comments"})
 		return
 	}
 
+	setNextCursor(c, nextCursor)
 	c.JSON(http.StatusOK, comments)
 }
 
+// GetReplies gets a page of a comment's replies with their own reply threads, e.g.
+// to load more replies from a comment's RepliesCursor. It takes the same query
+// parameters as GetComments.
+func (cc *CommentController) GetReplies(c *gin.Context) {
+	var parent models.Comment
+	if err := config.GetDB().First(&parent, "id = ?", c.Param("id")).Error; err != nil || isBlocked(config.GetDB(), viewerID(c), parent.UserID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+
+	var post models.Post
+	if err := config.GetDB().First(&post, "id = ?", parent.PostID).Error; err != nil || !canViewPost(config.GetDB(), &post, viewerID(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+
+	opts, err := getThreadOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := config.GetDB().Where("parent_id = ?", parent.ID)
+	replies, nextCursor, err := loadCommentPage(query, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch replies"})
+		return
+	}
+
+	setNextCursor(c, nextCursor)
+	c.JSON(http.StatusOK, replies)
+}
+
 // ReplyToComment creates a reply to a comment
 func (cc *CommentController) ReplyToComment(c *gin.Context) {
 	userID, exists := c.Get("userID")
@@ -82,40 +150,307 @@ func (cc *CommentController) ReplyToComment(c *gin.Context) {
 		return
 	}
 
-	commentID := c.Param("id")
-	var reply models.Comment
-	if err := c.ShouldBindJSON(&reply); err != nil {
+	var req commentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Get parent comment to get post ID
-	var parentComment models.Comment
-	if err := config.GetDB().First(&parentComment, "id = ?", commentID).Error; err != nil {
+	var parent models.Comment
+	if err := config.GetDB().First(&parent, "id = ?", c.Param("id")).Error; err != nil || parent.IsTombstone() ||
+		isBlocked(config.GetDB(), viewerID(c), parent.UserID) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Parent comment not found"})
 		return
 	}
 
-	commentUUID, _ := uuid.Parse(commentID)
-	reply.UserID = userID.(uuid.UUID)
-	reply.PostID = parentComment.PostID
-	reply.ParentID = &commentUUID
+	var post models.Post
+	if err := config.GetDB().First(&post, "id = ?", parent.PostID).Error; err != nil || !canViewPost(config.GetDB(), &post, viewerID(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Parent comment not found"})
+		return
+	}
 
-	tx := config.GetDB().Begin()
-	if err := tx.Create(&reply).Error; err != nil {
-		tx.Rollback()
+	reply := models.Comment{
+		PostID:  parent.PostID,
+		UserID:  userID.(uuid.UUID),
+		Content: req.Content,
+	}
+	if err := createComment(&post, &reply, &parent); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Parent comment not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reply"})
 		return
 	}
 
-	// Increment comment count
-	if err := tx.Model(&models.Post{}).Where("id = ?", parentComment.PostID).
+	linkCommentMentions(config.GetDB(), &reply)
+	c.JSON(http.StatusCreated, reply)
+}
+
+// createComment stores a comment on post or a reply to parent, updates the post's
+// comment count and the parent's reply count, and notifies mentioned users. The
+// post's and parent's authors are notified through a CommentCreated event.
+func createComment(post *models.Post, comment *models.Comment, parent *models.Comment) error {
+	if parent != nil {
+		comment.PostID = parent.PostID
+		comment.ParentID = &parent.ID
+		comment.Depth = parent.Depth + 1
+	}
+
+	tx := config.GetDB().Begin()
+
+	// Lock the parent so it cannot be deleted while the reply is added
+	if parent != nil {
+		var locked models.Comment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, "id = ? AND tombstoned_at IS NULL", parent.ID).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Create(comment).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Model(&models.Post{}).Where("id = ?", comment.PostID).
 		UpdateColumn("analytics__comment_count", gorm.Expr("analytics__comment_count + ?", 1)).Error; err != nil {
 		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment count"})
+		return err
+	}
+
+	if parent != nil {
+		if err := tx.Model(&models.Comment{}).Where("id = ?", parent.ID).
+			UpdateColumn("reply_count", gorm.Expr("reply_count + ?", 1)).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := syncMentions(tx, comment.UserID, comment.PostID, &comment.ID, comment.Content); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := emitMentions(tx, post, &comment.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := events.Emit(tx, events.CommentCreated{
+		CommentID: comment.ID,
+		PostID:    comment.PostID,
+		UserID:    comment.UserID,
+		ParentID:  comment.ParentID,
+	}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// UpdateComment edits the content of the caller's own comment, keeping the previous
+// version in the comment's edit history
+func (cc *CommentController) UpdateComment(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req struct {
+		Content string `json:"content" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx := config.GetDB().Begin()
+
+	var comment models.Comment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&comment, "id = ?", c.Param("id")).Error; err != nil || comment.IsTombstone() {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+	if comment.UserID != userID.(uuid.UUID) {
+		tx.Rollback()
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the author can edit this comment"})
+		return
+	}
+	if comment.Content == req.Content {
+		tx.Rollback()
+		c.JSON(http.StatusOK, comment)
+		return
+	}
+
+	if err := tx.Create(&models.CommentEdit{CommentID: comment.ID, Content: comment.Content}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+
+	now := time.Now()
+	comment.Content = req.Content
+	comment.EditedAt = &now
+	if err := tx.Model(&comment).Select("Content", "EditedAt").Updates(&comment).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+
+	var post models.Post
+	if err := tx.First(&post, "id = ?", comment.PostID).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+	if err := syncMentions(tx, comment.UserID, comment.PostID, &comment.ID, comment.Content); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save mentions"})
+		return
+	}
+	if err := emitMentions(tx, &post, &comment.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to notify mentioned users"})
 		return
 	}
 
 	tx.Commit()
-	c.JSON(http.StatusCreated, reply)
+	linkCommentMentions(config.GetDB(), &comment)
+	c.JSON(http.StatusOK, comment)
+}
+
+// GetCommentHistory lists the previous versions of a comment, most recent first
+func (cc *CommentController) GetCommentHistory(c *gin.Context) {
+	var comment models.Comment
+	if err := config.GetDB().First(&comment, "id = ?", c.Param("id")).Error; err != nil || comment.IsTombstone() ||
+		isBlocked(config.GetDB(), viewerID(c), comment.UserID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+
+	var post models.Post
+	if err := config.GetDB().First(&post, "id = ?", comment.PostID).Error; err != nil || !canViewPost(config.GetDB(), &post, viewerID(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+
+	var edits []models.CommentEdit
+	if err := config.GetDB().Where("comment_id = ?", comment.ID).Order("created_at DESC").Find(&edits).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch comment history"})
+		return
+	}
+	if err := linkCommentMentions(config.GetDB(), &comment); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch comment history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"comment": comment,
+		"edits":   edits,
+	})
+}
+
+// DeleteComment deletes a comment. Its author and the post's owner may delete it.
+// A comment that still has replies is left as a tombstone so the thread stays intact.
+func (cc *CommentController) DeleteComment(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	tx := config.GetDB().Begin()
+
+	var comment models.Comment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&comment, "id = ?", c.Param("id")).Error; err != nil || comment.IsTombstone() {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+
+	var post models.Post
+	if err := tx.First(&post, "id = ?", comment.PostID).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+	if comment.UserID != userID.(uuid.UUID) && post.UserID != userID.(uuid.UUID) {
+		tx.Rollback()
+		c.JSON(http.StatusForbidden, gin.H{"error": "Unauthorized to delete this comment"})
+		return
+	}
+
+	if err := removeComment(tx, &comment); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+
+	tx.Commit()
+	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted successfully"})
+}
+
+// removeComment deletes a comment, or turns it into a tombstone while it still has
+// replies, and keeps the post's comment count and the parents' reply counts in step
+func removeComment(tx *gorm.DB, comment *models.Comment) error {
+	// The edit history holds the author's content, so it goes either way
+	if err := tx.Where("comment_id = ?", comment.ID).Delete(&models.CommentEdit{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("comment_id = ?", comment.ID).Delete(&models.CommentReaction{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("comment_id = ?", comment.ID).Delete(&models.Mention{}).Error; err != nil {
+		return err
+	}
+
+	if comment.ReplyCount > 0 {
+		if err := tx.Model(comment).Updates(map[string]interface{}{
+			"content":       "",
+			"likes":         0,
+			"tombstoned_at": time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+	} else {
+		if err := tx.Delete(comment).Error; err != nil {
+			return err
+		}
+		if err := pruneCommentParents(tx, comment.ParentID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Model(&models.Post{}).Where("id = ?", comment.PostID).
+		UpdateColumn("analytics__comment_count", gorm.Expr("GREATEST(analytics__comment_count - 1, 0)")).Error
+}
+
+// pruneCommentParents lowers the reply count of a deleted comment's parent and
+// removes tombstones that no longer have any replies, walking up the thread
+func pruneCommentParents(tx *gorm.DB, parentID *uuid.UUID) error {
+	for parentID != nil {
+		var parent models.Comment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&parent, "id = ?", *parentID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+
+		if err := tx.Model(&parent).
+			UpdateColumn("reply_count", gorm.Expr("GREATEST(reply_count - 1, 0)")).Error; err != nil {
+			return err
+		}
+		if !parent.IsTombstone() || parent.ReplyCount > 1 {
+			return nil
+		}
+
+		if err := tx.Delete(&parent).Error; err != nil {
+			return err
+		}
+		parentID = parent.ParentID
+	}
+	return nil
 }
@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mentorship-backend/config"
+	"mentorship-backend/events"
+	"mentorship-backend/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReactToComment adds the caller's reaction to a comment, or changes it to another
+// type. The body is optional: {"type": "love"}; a plain like is the default.
+func (cc *CommentController) ReactToComment(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req struct {
+		Type string `json:"type"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Type == "" {
+		req.Type = models.ReactionLike
+	}
+	if !models.IsValidReaction(req.Type) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid reaction %q", req.Type)})
+		return
+	}
+
+	comment, ok := findReactableComment(c)
+	if !ok {
+		return
+	}
+
+	tx := config.GetDB().Begin()
+
+	var reaction models.CommentReaction
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("comment_id = ? AND user_id = ?", comment.ID, userID).
+		Take(&reaction).Error
+	status := http.StatusOK
+	switch {
+	case err == nil:
+		if reaction.Type != req.Type {
+			if err := tx.Model(&reaction).Where("comment_id = ? AND user_id = ?", comment.ID, userID).Update("type", req.Type).Error; err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to react to comment"})
+				return
+			}
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		reaction = models.CommentReaction{CommentID: comment.ID, UserID: userID.(uuid.UUID), Type: req.Type}
+		result := tx.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(&reaction)
+		if result.Error != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to react to comment"})
+			return
+		}
+		// A concurrent request may have inserted the reaction first
+		if result.RowsAffected > 0 {
+			status = http.StatusCreated
+			if err := tx.Model(&models.Comment{}).Where("id = ?", comment.ID).
+				UpdateColumn("likes", gorm.Expr("likes + ?", 1)).Error; err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update reaction count"})
+				return
+			}
+			if err := events.Emit(tx, events.CommentReacted{CommentID: comment.ID, UserID: userID.(uuid.UUID)}); err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create notification"})
+				return
+			}
+		}
+	default:
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to react to comment"})
+		return
+	}
+
+	var likes int
+	tx.Model(&models.Comment{}).Where("id = ?", comment.ID).Pluck("likes", &likes)
+	tx.Commit()
+
+	c.JSON(status, gin.H{
+		"reaction": req.Type,
+		"likes":    likes,
+	})
+}
+
+// RemoveCommentReaction removes the caller's reaction from a comment
+func (cc *CommentController) RemoveCommentReaction(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	comment, ok := findReactableComment(c)
+	if !ok {
+		return
+	}
+
+	tx := config.GetDB().Begin()
+	result := tx.Where("comment_id = ? AND user_id = ?", comment.ID, userID).Delete(&models.CommentReaction{})
+	if result.Error != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove reaction"})
+		return
+	}
+	if result.RowsAffected > 0 {
+		if err := tx.Model(&models.Comment{}).Where("id = ?", comment.ID).
+			UpdateColumn("likes", gorm.Expr("GREATEST(likes - 1, 0)")).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update reaction count"})
+			return
+		}
+	}
+
+	var likes int
+	tx.Model(&models.Comment{}).Where("id = ?", comment.ID).Pluck("likes", &likes)
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{"likes": likes})
+}
+
+// findReactableComment loads the comment in the route if the viewer can see it and it
+// is not a tombstone, responding with 404 otherwise
+func findReactableComment(c *gin.Context) (*models.Comment, bool) {
+	var comment models.Comment
+	if err := config.GetDB().First(&comment, "id = ?", c.Param("id")).Error; err != nil || comment.IsTombstone() ||
+		isBlocked(config.GetDB(), viewerID(c), comment.UserID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return nil, false
+	}
+
+	var post models.Post
+	if err := config.GetDB().First(&post, "id = ?", comment.PostID).Error; err != nil || !canViewPost(config.GetDB(), &post, viewerID(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return nil, false
+	}
+	return &comment, true
+}
+
+// notifyCommentReaction lets a comment's author know someone reacted to it
+func notifyCommentReaction(tx *gorm.DB, comment *models.Comment, actorID uuid.UUID) error {
+	if comment.UserID == actorID {
+		return nil
+	}
+
+	var actor models.User
+	if err := tx.First(&actor, "id = ?", actorID).Error; err != nil {
+		return err
+	}
+
+	notification := models.Notification{
+		UserID:    comment.UserID,
+		ActorID:   actorID,
+		PostID:    &comment.PostID,
+		CommentID: &comment.ID,
+		Type:      models.NotificationTypeCommentReaction,
+		Message:   fmt.Sprintf("%s reacted to your comment", actor.Name),
+	}
+	return notify(tx, notification)
+}
@@ -0,0 +1,304 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mentorship-backend/config"
+	"mentorship-backend/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	commentSortNewest = "newest"
+	commentSortOldest = "oldest"
+	commentSortTop    = "top" // Most liked first
+)
+
+const (
+	defaultThreadDepth = 3
+	maxThreadDepth     = 10
+	defaultReplyLimit  = 3
+	maxReplyLimit      = 20
+)
+
+// commentThread is a comment with the first replies of each level loaded beneath it
+type commentThread struct {
+	models.Comment
+	Replies        []*commentThread
+	HasMoreReplies bool           // More replies exist than were loaded
+	RepliesCursor  string         `json:",omitempty"` // Cursor to load the remaining replies from
+	Reactions      map[string]int // Reaction counts by type
+	ViewerReaction string         `json:",omitempty"` // The viewer's own reaction
+}
+
+// newCommentThread wraps a comment for a thread. Tombstones only keep their place
+// in the thread and do not reveal who wrote them.
+func newCommentThread(comment models.Comment) *commentThread {
+	if comment.IsTombstone() {
+		comment.UserID = uuid.Nil
+		comment.User = models.User{}
+		comment.EditedAt = nil
+	}
+	return &commentThread{Comment: comment}
+}
+
+// threadOptions controls how much of a comment thread is loaded
+type threadOptions struct {
+	Sort       string
+	Depth      int // Levels of comments to load, counting the requested level
+	ReplyLimit int // Replies loaded per comment on deeper levels
+	Limit      int // Comments loaded on the requested level
+	Cursor     *commentCursor
+	Viewer     *uuid.UUID
+}
+
+// getThreadOptions reads the sort, depth, replies, limit and cursor query parameters
+func getThreadOptions(c *gin.Context) (threadOptions, error) {
+	opts := threadOptions{
+		Sort:       c.DefaultQuery("sort", commentSortNewest),
+		Depth:      queryInt(c, "depth", defaultThreadDepth, maxThreadDepth),
+		ReplyLimit: queryInt(c, "replies", defaultReplyLimit, maxReplyLimit),
+		Limit:      queryInt(c, "limit", defaultPageSize, maxPageSize),
+		Viewer:     viewerID(c),
+	}
+	if opts.Sort != commentSortNewest && opts.Sort != commentSortOldest && opts.Sort != commentSortTop {
+		return opts, fmt.Errorf("sort must be newest, oldest or top")
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		decoded, err := decodeCommentCursor(cursor)
+		if err != nil {
+			return opts, fmt.Errorf("invalid cursor")
+		}
+		opts.Cursor = decoded
+	}
+	return opts, nil
+}
+
+// queryInt reads a positive integer query parameter, capped at max
+func queryInt(c *gin.Context, name string, fallback int, max int) int {
+	value, err := strconv.Atoi(c.Query(name))
+	if err != nil || value < 1 {
+		return fallback
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
+
+// commentCursor marks the last comment of a page by its sort keys
+type commentCursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        uuid.UUID `json:"i"`
+	Likes     int       `json:"l"`
+}
+
+func encodeCommentCursor(comment *models.Comment) string {
+	data, _ := json.Marshal(commentCursor{CreatedAt: comment.CreatedAt, ID: comment.ID, Likes: comment.Likes})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCommentCursor(value string) (*commentCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var cursor commentCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// commentOrder is the ORDER BY clause of a sort, with the ID as tiebreaker
+func commentOrder(sort string) string {
+	switch sort {
+	case commentSortOldest:
+		return "created_at ASC, id ASC"
+	case commentSortTop:
+		return "likes DESC, created_at DESC, id DESC"
+	default:
+		return "created_at DESC, id DESC"
+	}
+}
+
+// afterCursor limits a comments query to the rows following the cursor in the sort order
+func afterCursor(sort string, cursor *commentCursor) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if cursor == nil {
+			return db
+		}
+		switch sort {
+		case commentSortOldest:
+			return db.Where("(created_at, id) > (?, ?)", cursor.CreatedAt, cursor.ID)
+		case commentSortTop:
+			return db.Where("(likes, created_at, id) < (?, ?, ?)", cursor.Likes, cursor.CreatedAt, cursor.ID)
+		default:
+			return db.Where("(created_at, id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+		}
+	}
+}
+
+// loadCommentPage loads one page of the comments matched by query along with
+// their reply threads, and returns the cursor of the next page if there is one
+func loadCommentPage(query *gorm.DB, opts threadOptions) ([]*commentThread, string, error) {
+	var comments []models.Comment
+	if err := query.Scopes(afterCursor(opts.Sort, opts.Cursor), notBlocked(opts.Viewer, "comments.user_id")).
+		Preload("User").
+		Order(commentOrder(opts.Sort)).
+		Limit(opts.Limit + 1).
+		Find(&comments).Error; err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(comments) > opts.Limit {
+		comments = comments[:opts.Limit]
+		nextCursor = encodeCommentCursor(&comments[len(comments)-1])
+	}
+
+	threads := make([]*commentThread, len(comments))
+	for i := range comments {
+		threads[i] = newCommentThread(comments[i])
+	}
+	if err := loadReplies(threads, opts, 1); err != nil {
+		return nil, "", err
+	}
+	if err := loadReactions(threads, opts.Viewer); err != nil {
+		return nil, "", err
+	}
+	if err := linkThreadMentions(threads); err != nil {
+		return nil, "", err
+	}
+	return threads, nextCursor, nil
+}
+
+// setNextCursor tells the client where the next page of comments starts, if there is one
+func setNextCursor(c *gin.Context, cursor string) {
+	if cursor != "" {
+		c.Header("X-Next-Cursor", cursor)
+	}
+}
+
+// loadReplies loads the first replies of every comment one level at a time,
+// until the requested depth is reached
+func loadReplies(parents []*commentThread, opts threadOptions, level int) error {
+	var parentIDs []uuid.UUID
+	byID := make(map[uuid.UUID]*commentThread, len(parents))
+	for _, parent := range parents {
+		if parent.ReplyCount == 0 {
+			continue
+		}
+		if level >= opts.Depth {
+			parent.HasMoreReplies = true
+			continue
+		}
+		parentIDs = append(parentIDs, parent.ID)
+		byID[parent.ID] = parent
+	}
+	if len(parentIDs) == 0 {
+		return nil
+	}
+
+	// Number the replies of each parent so one query can take the first few of each
+	order := commentOrder(opts.Sort)
+	ranked := config.GetDB().Model(&models.Comment{}).
+		Select("comments.*, ROW_NUMBER() OVER (PARTITION BY parent_id ORDER BY "+order+") AS reply_rank").
+		Where("parent_id IN ?", parentIDs).
+		Scopes(notBlocked(opts.Viewer, "comments.user_id"))
+
+	var replies []models.Comment
+	if err := config.GetDB().Table("(?) AS ranked", ranked).
+		Where("reply_rank <= ?", opts.ReplyLimit+1).
+		Preload("User").
+		Order(order).
+		Find(&replies).Error; err != nil {
+		return err
+	}
+
+	var children []*commentThread
+	for i := range replies {
+		parent := byID[*replies[i].ParentID]
+		if len(parent.Replies) == opts.ReplyLimit {
+			parent.HasMoreReplies = true
+			parent.RepliesCursor = encodeCommentCursor(&parent.Replies[len(parent.Replies)-1].Comment)
+			continue
+		}
+		child := newCommentThread(replies[i])
+		parent.Replies = append(parent.Replies, child)
+		children = append(children, child)
+	}
+
+	return loadReplies(children, opts, level+1)
+}
+
+// loadReactions fills in the reaction counts of every comment in the threads and
+// the viewer's own reactions
+func loadReactions(threads []*commentThread, viewer *uuid.UUID) error {
+	byID := make(map[uuid.UUID]*commentThread)
+	var collect func([]*commentThread)
+	collect = func(threads []*commentThread) {
+		for _, thread := range threads {
+			thread.Reactions = map[string]int{}
+			byID[thread.ID] = thread
+			collect(thread.Replies)
+		}
+	}
+	collect(threads)
+	if len(byID) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(byID))
+	for id := range byID {
+		ids = append(ids, id)
+	}
+
+	var counts []struct {
+		CommentID uuid.UUID
+		Type      string
+		Count     int
+	}
+	if err := config.GetDB().Model(&models.CommentReaction{}).
+		Select("comment_id, type, COUNT(*) AS count").
+		Where("comment_id IN ?", ids).
+		Group("comment_id, type").
+		Scan(&counts).Error; err != nil {
+		return err
+	}
+	for _, count := range counts {
+		byID[count.CommentID].Reactions[count.Type] = count.Count
+	}
+
+	if viewer == nil {
+		return nil
+	}
+	var own []models.CommentReaction
+	if err := config.GetDB().Where("comment_id IN ? AND user_id = ?", ids, *viewer).Find(&own).Error; err != nil {
+		return err
+	}
+	for _, reaction := range own {
+		byID[reaction.CommentID].ViewerReaction = reaction.Type
+	}
+	return nil
+}
+
+// linkThreadMentions fills in the mention spans of every comment in the threads
+func linkThreadMentions(threads []*commentThread) error {
+	var comments []*models.Comment
+	var collect func([]*commentThread)
+	collect = func(threads []*commentThread) {
+		for _, thread := range threads {
+			comments = append(comments, &thread.Comment)
+			collect(thread.Replies)
+		}
+	}
+	collect(threads)
+	return linkCommentMentions(config.GetDB(), comments...)
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"mentorship-backend/config"
+	"mentorship-backend/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+)
+
+// maxDevicesPerUser caps the push tokens kept per user, dropping the least
+// recently registered ones first
+const maxDevicesPerUser = 10
+
+type DeviceController struct{}
+
+func NewDeviceController() *DeviceController {
+	return &DeviceController{}
+}
+
+// RegisterDevice stores the push token of the current user's device. Registering
+// a token again refreshes it, and moves it over if another user registered it.
+func (dc *DeviceController) RegisterDevice(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req struct {
+		Token    string `json:"token" binding:"required,max=512"`
+		Platform string `json:"platform" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.IsValidDevicePlatform(req.Platform) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Platform must be ios, android or web"})
+		return
+	}
+
+	tx := config.GetDB().Begin()
+	device := models.DeviceToken{
+		UserID:    userID.(uuid.UUID),
+		Token:     req.Token,
+		Platform:  req.Platform,
+		UpdatedAt: time.Now(),
+	}
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "token"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "platform", "updated_at"}),
+	}).Create(&device).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register device"})
+		return
+	}
+
+	// Forget the devices the user has not registered from in the longest time
+	if err := tx.Where("user_id = ? AND id NOT IN (?)", userID,
+		tx.Model(&models.DeviceToken{}).Select("id").Where("user_id = ?", userID).
+			Order("updated_at DESC").Limit(maxDevicesPerUser)).
+		Delete(&models.DeviceToken{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register device"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register device"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Device registered"})
+}
+
+// UnregisterDevice stops pushes to one of the current user's devices, e.g. when
+// they sign out on it
+func (dc *DeviceController) UnregisterDevice(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := config.GetDB().Where("user_id = ? AND token = ?", userID, c.Param("token")).
+		Delete(&models.DeviceToken{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unregister device"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Device unregistered"})
+}
@@ -1,13 +1,15 @@
 package controllers
 
 import (
-	"fmt"
 	"mentorship-backend/config"
+	"mentorship-backend/events"
 	"mentorship-backend/models"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type FollowController struct{}
@@ -33,7 +35,8 @@ func (fc *FollowController) FollowUser(c *gin.Context) {
 
 	// Check if user exists
 	var followingUser models.User
-	if err := config.GetDB().First(&followingUser, "id = ?", followingUUID).Error; err != nil {
+	if err := config.GetDB().First(&followingUser, "id = ?", followingUUID).Error; err != nil ||
+		isBlocked(config.GetDB(), viewerID(c), followingUUID) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User to follow not found"})
 		return
 	}
@@ -44,44 +47,47 @@ func (fc *FollowController) FollowUser(c *gin.Context) {
 		return
 	}
 
-	// Check if already following
-	var existingFollow models.Follow
-	result := config.GetDB().Where("follower_id = ? AND following_id = ?", followerID, followingUUID).First(&existingFollow)
-	if result.Error == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Already following this user"})
+	// Following is idempotent, asking again just returns the current state
+	if isFollowing(config.GetDB(), followerID.(uuid.UUID), followingUUID) {
+		respondFollowState(c, http.StatusOK, "Already following this user", followerID.(uuid.UUID), followingUUID)
 		return
 	}
 
-	follow := models.Follow{
-		FollowerID:  followerID.(uuid.UUID),
-		FollowingID: followingUUID,
+	// Private users approve their followers
+	if followingUser.IsPrivate {
+		request, created, err := requestToFollow(followerID.(uuid.UUID), &followingUser)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send follow request"})
+			return
+		}
+		status := http.StatusOK
+		if created {
+			status = http.StatusAccepted
+		}
+		c.JSON(status, gin.H{"message": "Follow request sent", "request": request})
+		return
 	}
 
 	tx := config.GetDB().Begin()
-	if err := tx.Create(&follow).Error; err != nil {
+	created, err := createFollow(tx, followerID.(uuid.UUID), followingUUID, false)
+	if err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to follow user"})
 		return
 	}
-
-	// Create notification for the followed user
-	notification := &models.Notification{
-		UserID:   followingUser.ID,
-		ActorID:  followerID.(uuid.UUID),
-		Type:     models.NotificationTypeFollow,
-		Message:  fmt.Sprintf("%s started following you", followingUser.Name),
-	}
-
-	notificationController := NewNotificationController()
-	if err := notificationController.CreateNotification(notification); err != nil {
+	if !created {
+		// A concurrent request got there first
 		tx.Rollback()
-		c.JSON(500, gin.H{"error": "Failed to create notification"})
+		respondFollowState(c, http.StatusOK, "Already following this user", followerID.(uuid.UUID), followingUUID)
 		return
 	}
 
-	tx.Commit()
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to follow user"})
+		return
+	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Successfully followed user"})
+	respondFollowState(c, http.StatusCreated, "Successfully followed user", followerID.(uuid.UUID), followingUUID)
 }
 
 // UnfollowUser handles unfollowing a user/mentor
@@ -99,13 +105,40 @@ func (fc *FollowController) UnfollowUser(c *gin.Context) {
 		return
 	}
 
-	result := config.GetDB().Where("follower_id = ? AND following_id = ?", followerID, followingUUID).Delete(&models.Follow{})
+	tx := config.GetDB().Begin()
+	result := tx.Where("follower_id = ? AND following_id = ?", followerID, followingUUID).Delete(&models.Follow{})
+	if result.Error != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unfollow user"})
+		return
+	}
 	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Not following this user"})
+		tx.Rollback()
+
+		// Withdraw a pending follow request instead
+		result = config.GetDB().Where("requester_id = ? AND target_id = ? AND status = ?", followerID, followingUUID, models.FollowRequestPending).
+			Delete(&models.FollowRequest{})
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to withdraw follow request"})
+			return
+		}
+		if result.RowsAffected > 0 {
+			respondFollowState(c, http.StatusOK, "Follow request withdrawn", followerID.(uuid.UUID), followingUUID)
+			return
+		}
+		// Unfollowing is idempotent, there is nothing left to undo
+		respondFollowState(c, http.StatusOK, "Not following this user", followerID.(uuid.UUID), followingUUID)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Successfully unfollowed user"})
+	if err := adjustFollowCounts(tx, followerID.(uuid.UUID), followingUUID, -int(result.RowsAffected)); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update follow counts"})
+		return
+	}
+
+	tx.Commit()
+	respondFollowState(c, http.StatusOK, "Successfully unfollowed user", followerID.(uuid.UUID), followingUUID)
 }
 
 // GetFollowers gets all followers of a user
@@ -117,8 +150,20 @@ func (fc *FollowController) GetFollowers(c *gin.Context) {
 		return
 	}
 
+	var user models.User
+	viewer := viewerID(c)
+	if err := config.GetDB().First(&user, "id = ?", userUUID).Error; err != nil || isBlocked(config.GetDB(), viewer, user.ID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !canViewProfile(config.GetDB(), &user, viewer) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This account is private"})
+		return
+	}
+
 	var follows []models.Follow
 	if err := config.GetDB().Where("following_id = ?", userUUID).
+		Scopes(notBlocked(viewer, "follows.follower_id")).
 		Preload("Follower").
 		Find(&follows).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch followers"})
@@ -148,8 +193,20 @@ func (fc *FollowController) GetFollowing(c *gin.Context) {
 		return
 	}
 
+	var user models.User
+	viewer := viewerID(c)
+	if err := config.GetDB().First(&user, "id = ?", userUUID).Error; err != nil || isBlocked(config.GetDB(), viewer, user.ID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !canViewProfile(config.GetDB(), &user, viewer) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This account is private"})
+		return
+	}
+
 	var follows []models.Follow
 	if err := config.GetDB().Where("follower_id = ?", userUUID).
+		Scopes(notBlocked(viewer, "follows.following_id")).
 		Preload("Following").
 		Find(&follows).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch following"})
@@ -169,3 +226,61 @@ func (fc *FollowController) GetFollowing(c *gin.Context) {
 
 	c.JSON(http.StatusOK, following)
 }
+
+// adjustFollowCounts keeps the follower and following counters of both users in
+// step with follows being added (positive delta) or removed (negative delta)
+func adjustFollowCounts(tx *gorm.DB, followerID, followingID uuid.UUID, delta int) error {
+	if err := tx.Model(&models.User{}).Where("id = ?", followerID).
+		UpdateColumn("following_count", gorm.Expr("GREATEST(following_count + ?, 0)", delta)).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.User{}).Where("id = ?", followingID).
+		UpdateColumn("follower_count", gorm.Expr("GREATEST(follower_count + ?, 0)", delta)).Error
+}
+
+// liveFollowConflict matches the unique index on follows that have not been undone
+var liveFollowConflict = clause.OnConflict{
+	Columns:     []clause.Column{{Name: "follower_id"}, {Name: "following_id"}},
+	TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Eq{Column: clause.Column{Name: "deleted_at"}, Value: nil}}},
+	DoNothing:   true,
+}
+
+// createFollow makes followerID follow followingID unless they already do, and
+// reports whether a follow was added. Concurrent calls add at most one.
+func createFollow(tx *gorm.DB, followerID, followingID uuid.UUID, viaRequest bool) (bool, error) {
+	follow := models.Follow{FollowerID: followerID, FollowingID: followingID}
+	result := tx.Omit(clause.Associations).Clauses(liveFollowConflict).Create(&follow)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	if err := adjustFollowCounts(tx, followerID, followingID, 1); err != nil {
+		return false, err
+	}
+	return true, events.Emit(tx, events.UserFollowed{FollowerID: followerID, FollowingID: followingID, ViaRequest: viaRequest})
+}
+
+// respondFollowState writes whether the follower follows, or has asked to follow,
+// the other user along with that user's follower count
+func respondFollowState(c *gin.Context, status int, message string, followerID, followingID uuid.UUID) {
+	db := config.GetDB()
+
+	var followerCount int
+	if err := db.Model(&models.User{}).Where("id = ?", followingID).Select("follower_count").Scan(&followerCount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch follow state"})
+		return
+	}
+	var requests int64
+	if err := db.Model(&models.FollowRequest{}).
+		Where("requester_id = ? AND target_id = ? AND status = ?", followerID, followingID, models.FollowRequestPending).
+		Count(&requests).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch follow state"})
+		return
+	}
+
+	c.JSON(status, gin.H{
+		"message":       message,
+		"following":     isFollowing(db, followerID, followingID),
+		"requested":     requests > 0,
+		"followerCount": followerCount,
+	})
+}
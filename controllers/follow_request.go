@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"errors"
+	"mentorship-backend/config"
+	"mentorship-backend/events"
+	"mentorship-backend/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ListFollowRequests lists the pending requests to follow the current user, oldest first
+func (fc *FollowController) ListFollowRequests(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	query := config.GetDB().Model(&models.FollowRequest{}).
+		Where("target_id = ? AND status = ?", userID, models.FollowRequestPending)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch follow requests"})
+		return
+	}
+
+	page := getPagination(c)
+	var requests []models.FollowRequest
+	if err := query.Preload("Requester").
+		Order("created_at ASC").
+		Scopes(page.scope).
+		Find(&requests).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch follow requests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"requests": requests,
+		"page":     page.Page,
+		"limit":    page.Limit,
+		"total":    total,
+	})
+}
+
+// ApproveFollowRequest lets the requester follow the current user
+func (fc *FollowController) ApproveFollowRequest(c *gin.Context) {
+	fc.respondToFollowRequest(c, models.FollowRequestApproved)
+}
+
+// RejectFollowRequest turns down a request to follow the current user
+func (fc *FollowController) RejectFollowRequest(c *gin.Context) {
+	fc.respondToFollowRequest(c, models.FollowRequestRejected)
+}
+
+func (fc *FollowController) respondToFollowRequest(c *gin.Context, status string) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	tx := config.GetDB().Begin()
+
+	var request models.FollowRequest
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&request, "id = ? AND target_id = ? AND status = ?", c.Param("id"), userID, models.FollowRequestPending).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Follow request not found"})
+		return
+	}
+
+	var err error
+	if status == models.FollowRequestApproved {
+		err = approveFollowRequest(tx, &request)
+	} else {
+		now := time.Now()
+		request.Status = models.FollowRequestRejected
+		request.RespondedAt = &now
+		err = tx.Model(&request).Select("Status", "RespondedAt").Updates(&request).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update follow request"})
+		return
+	}
+
+	tx.Commit()
+	c.JSON(http.StatusOK, request)
+}
+
+// requestToFollow asks a private user for permission to follow them. It reports
+// whether a new request was made, as opposed to one already pending.
+func requestToFollow(requesterID uuid.UUID, target *models.User) (*models.FollowRequest, bool, error) {
+	tx := config.GetDB().Begin()
+
+	var request models.FollowRequest
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&request, "requester_id = ? AND target_id = ?", requesterID, target.ID).Error
+	switch {
+	case err == nil && request.Status == models.FollowRequestPending:
+		tx.Rollback()
+		return &request, false, nil
+	case err == nil:
+		// Ask again after a rejection, or after unfollowing
+		request.Status = models.FollowRequestPending
+		request.RespondedAt = nil
+		request.CreatedAt = time.Now()
+		err = tx.Model(&request).Select("Status", "RespondedAt", "CreatedAt").Updates(&request).Error
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		request = models.FollowRequest{RequesterID: requesterID, TargetID: target.ID}
+		err = tx.Create(&request).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, false, err
+	}
+
+	if err := events.Emit(tx, events.FollowRequested{RequestID: request.ID, RequesterID: requesterID, TargetID: target.ID}); err != nil {
+		tx.Rollback()
+		return nil, false, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, false, err
+	}
+	return &request, true, nil
+}
+
+// approveFollowRequest makes the requester a follower of the target and lets the
+// requester know
+func approveFollowRequest(tx *gorm.DB, request *models.FollowRequest) error {
+	if _, err := createFollow(tx, request.RequesterID, request.TargetID, true); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	request.Status = models.FollowRequestApproved
+	request.RespondedAt = &now
+	if err := tx.Model(request).Select("Status", "RespondedAt").Updates(request).Error; err != nil {
+		return err
+	}
+
+	return events.Emit(tx, events.FollowRequestApproved{RequestID: request.ID, RequesterID: request.RequesterID, TargetID: request.TargetID})
+}
+
+// approvePendingFollowRequests approves every pending request to follow a user,
+// e.g. once their account is no longer private
+func approvePendingFollowRequests(tx *gorm.DB, userID uuid.UUID) error {
+	var requests []models.FollowRequest
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("target_id = ? AND status = ?", userID, models.FollowRequestPending).
+		Find(&requests).Error; err != nil {
+		return err
+	}
+	for i := range requests {
+		if err := approveFollowRequest(tx, &requests[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
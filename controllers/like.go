@@ -1,13 +1,15 @@
 package controllers
 
 import (
-	"fmt"
 	"mentorship-backend/config"
+	"mentorship-backend/events"
 	"mentorship-backend/models"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type LikeController struct{}
@@ -16,109 +18,121 @@ func NewLikeController() *LikeController {
 	return &LikeController{}
 }
 
-// LikePost handles liking a post
+// LikePost handles liking a post. Liking is idempotent, liking a post again just
+// returns the current state.
 func (lc *LikeController) LikePost(c *gin.Context) {
-	var like models.Like
-	if err := c.ShouldBindJSON(&like); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
-	// Check if user has already liked this post
-	var existingLike models.Like
-	if err := config.GetDB().Where("post_id = ? AND user_id = ?", like.PostID, like.UserID).First(&existingLike).Error; err == nil {
-		c.JSON(400, gin.H{"error": "Post already liked"})
+	var post models.Post
+	if err := config.GetDB().First(&post, "id = ?", c.Param("id")).Error; err != nil || !canViewPost(config.GetDB(), &post, viewerID(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
 		return
 	}
 
+	like := models.Like{PostID: post.ID, UserID: userID.(uuid.UUID)}
+
 	tx := config.GetDB().Begin()
-	if err := tx.Create(&like).Error; err != nil {
+	// Only the first like creates the row and counts towards the post's likes
+	result := tx.Omit(clause.Associations).Clauses(liveLikeConflict).Create(&like)
+	if result.Error != nil {
 		tx.Rollback()
-		c.JSON(500, gin.H{"error": "Failed to like post"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to like post"})
 		return
 	}
-
-	// Update post likes count
-	if err := tx.Model(&models.Post{}).Where("id = ?", like.PostID).Update("likes", gorm.Expr("likes + 1")).Error; err != nil {
+	if result.RowsAffected == 0 {
 		tx.Rollback()
-		c.JSON(500, gin.H{"error": "Failed to update likes count"})
+		respondLikeState(c, "Post already liked", like.UserID, post.ID)
 		return
 	}
 
-	// Get post and user details
-	var post models.Post
-	if err := tx.First(&post, like.PostID).Error; err != nil {
+	// Update post likes count
+	if err := tx.Model(&models.Post{}).Where("id = ?", post.ID).
+		UpdateColumn("analytics__likes", gorm.Expr("analytics__likes + 1")).Error; err != nil {
 		tx.Rollback()
-		c.JSON(500, gin.H{"error": "Failed to fetch post"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update likes count"})
 		return
 	}
 
-	var user models.User
-	if err := tx.First(&user, like.UserID).Error; err != nil {
+	if err := events.Emit(tx, events.PostLiked{PostID: post.ID, UserID: like.UserID}); err != nil {
 		tx.Rollback()
-		c.JSON(500, gin.H{"error": "Failed to fetch user"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to like post"})
 		return
 	}
 
-	notificationController := NewNotificationController()
-	// Create notification for the post owner
-	postOwnerID := post.UserID
-	if postOwnerID != like.UserID {
-		notification := &models.Notification{
-			UserID:   postOwnerID,
-			ActorID:  like.UserID,
-			PostID:   &post.ID,
-			Type:     models.NotificationTypeLike,
-			Message:  fmt.Sprintf("%s liked your post", user.Name),
-		}
-
-		if err := notificationController.CreateNotification(notification); err != nil {
-			tx.Rollback()
-			c.JSON(500, gin.H{"error": "Failed to create notification"})
-			return
-		}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to like post"})
+		return
 	}
-
-	tx.Commit()
-	c.JSON(200, gin.H{"message": "Post liked successfully"})
+	respondLikeState(c, "Post liked successfully", like.UserID, post.ID)
 }
 
-// UnlikePost handles unliking a post
+// UnlikePost handles unliking a post. Unliking a post that isn't liked is a no-op.
 func (lc *LikeController) UnlikePost(c *gin.Context) {
-	postId := c.Param("id")
-	userId := c.GetHeader("User-Id") // Get from auth middleware
-
-	if postId == "" || userId == "" {
-		c.JSON(400, gin.H{"error": "Post ID and User ID are required"})
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
-	// Convert IDs to UUID
-	postUUID, err := uuid.Parse(postId)
+	postUUID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		c.JSON(400, gin.H{"error": "Invalid post ID"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
 		return
 	}
 
-	userUUID, err := uuid.Parse(userId)
-	if err != nil {
-		c.JSON(400, gin.H{"error": "Invalid user ID"})
+	tx := config.GetDB().Begin()
+	result := tx.Where("post_id = ? AND user_id = ?", postUUID, userID).Delete(&models.Like{})
+	if result.Error != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlike post"})
 		return
 	}
 
-	// Find and delete the like
-	if err := config.GetDB().Where("post_id = ? AND user_id = ?", postUUID, userUUID).Delete(&models.Like{}).Error; err != nil {
-		c.JSON(500, gin.H{"error": "Failed to unlike post"})
-		return
+	// Update post likes count
+	if result.RowsAffected > 0 {
+		if err := tx.Model(&models.Post{}).Where("id = ?", postUUID).
+			UpdateColumn("analytics__likes", gorm.Expr("GREATEST(analytics__likes - ?, 0)", result.RowsAffected)).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update likes count"})
+			return
+		}
 	}
 
-	// Update post likes count
-	if err := config.GetDB().Model(&models.Post{}).Where("id = ?", postUUID).Update("likes", gorm.Expr("likes - 1")).Error; err != nil {
-		c.JSON(500, gin.H{"error": "Failed to update likes count"})
+	tx.Commit()
+	respondLikeState(c, "Post unliked successfully", userID.(uuid.UUID), postUUID)
+}
+
+// liveLikeConflict matches the unique index on likes that have not been undone
+var liveLikeConflict = clause.OnConflict{
+	Columns:     []clause.Column{{Name: "post_id"}, {Name: "user_id"}},
+	TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Eq{Column: clause.Column{Name: "deleted_at"}, Value: nil}}},
+	DoNothing:   true,
+}
+
+// respondLikeState writes whether the user likes the post along with its like count
+func respondLikeState(c *gin.Context, message string, userID, postID uuid.UUID) {
+	db := config.GetDB()
+
+	var likeCount int
+	if err := db.Model(&models.Post{}).Where("id = ?", postID).Select("analytics__likes").Scan(&likeCount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch like state"})
+		return
+	}
+	var likes int64
+	if err := db.Model(&models.Like{}).Where("post_id = ? AND user_id = ?", postID, userID).Count(&likes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch like state"})
 		return
 	}
 
-	c.JSON(200, gin.H{"message": "Post unliked successfully"})
+	c.JSON(http.StatusOK, gin.H{
+		"message":   message,
+		"liked":     likes > 0,
+		"likeCount": likeCount,
+	})
 }
 
 // GetPostLikes gets all users who liked a post
@@ -136,8 +150,16 @@ func (lc *LikeController) GetPostLikes(c *gin.Context) {
 		return
 	}
 
+	var post models.Post
+	if err := config.GetDB().First(&post, "id = ?", postUUID).Error; err != nil || !canViewPost(config.GetDB(), &post, viewerID(c)) {
+		c.JSON(404, gin.H{"error": "Post not found"})
+		return
+	}
+
 	var likes []models.Like
-	if err := config.GetDB().Preload("User").Where("post_id = ?", postUUID).Find(&likes).Error; err != nil {
+	if err := config.GetDB().Preload("User").Where("post_id = ?", postUUID).
+		Scopes(notBlocked(viewerID(c), "likes.user_id")).
+		Find(&likes).Error; err != nil {
 		c.JSON(500, gin.H{"error": "Failed to fetch likes"})
 		return
 	}
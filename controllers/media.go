@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"log"
+	"mentorship-backend/config"
+	"mentorship-backend/models"
+	"mentorship-backend/utils"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// enqueueMediaDeletion records stored assets that must be removed from media storage.
+// Run it inside the transaction that drops the references so nothing is lost on rollback.
+func enqueueMediaDeletion(tx *gorm.DB, assets []utils.StoredAsset) error {
+	deletions := make([]models.MediaDeletion, 0, len(assets))
+	for _, asset := range assets {
+		if asset.PublicID == "" {
+			continue
+		}
+		deletions = append(deletions, models.MediaDeletion{
+			PublicID:     asset.PublicID,
+			ResourceType: asset.ResourceType,
+		})
+	}
+	if len(deletions) == 0 {
+		return nil
+	}
+	return tx.Create(&deletions).Error
+}
+
+// discardStoredAssets removes stored files that never got referenced
+func discardStoredAssets(assets []utils.StoredAsset) {
+	if err := enqueueMediaDeletion(config.GetDB(), assets); err != nil {
+		log.Printf("Failed to queue media deletion: %v", err)
+		return
+	}
+	processMediaDeletionsNow()
+}
+
+// postMediaAssets lists the stored assets behind post media records
+func postMediaAssets(media []models.PostMedia) []utils.StoredAsset {
+	assets := make([]utils.StoredAsset, 0, len(media))
+	for _, item := range media {
+		publicID, resourceType := item.PublicID, item.ResourceType
+		if publicID == "" {
+			// Media uploaded before public IDs were recorded
+			var ok bool
+			if publicID, resourceType, ok = utils.PublicIDFromURL(item.URL); !ok {
+				continue
+			}
+		}
+		if resourceType == "" {
+			resourceType = item.Type
+		}
+		assets = append(assets, utils.StoredAsset{PublicID: publicID, ResourceType: resourceType})
+	}
+	return assets
+}
+
+// mediaDeletionLease is how long claimed deletions are left to their worker before
+// another one may pick them up again
+const mediaDeletionLease = 10 * time.Minute
+
+// ProcessMediaDeletions deletes queued assets from media storage. Deletions are
+// claimed in a short transaction and carried out outside of it, so slow storage
+// holds no locks. Failures are retried with exponential backoff until
+// MaxMediaDeletionAttempts is reached.
+func ProcessMediaDeletions() error {
+	deletions, err := claimMediaDeletions()
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for i := range deletions {
+		deletion := &deletions[i]
+		err := utils.DeleteMedia(deletion.PublicID, deletion.ResourceType)
+		if err == nil {
+			if err := config.GetDB().Delete(deletion).Error; err != nil {
+				return err
+			}
+			continue
+		}
+
+		failed++
+		deletion.Attempts++
+		deletion.LastError = err.Error()
+		deletion.NextAttemptAt = time.Now().Add(mediaDeletionBackoff(deletion.Attempts))
+		if deletion.Attempts >= models.MaxMediaDeletionAttempts {
+			deletion.Status = models.MediaDeletionFailed
+			log.Printf("Giving up deleting media %s after %d attempts: %v", deletion.PublicID, deletion.Attempts, err)
+		}
+		if err := config.GetDB().Save(deletion).Error; err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		log.Printf("Failed to delete %d of %d queued media files", failed, len(deletions))
+	}
+	return nil
+}
+
+// claimMediaDeletions picks the deletions that are due and leases them to this worker
+func claimMediaDeletions() ([]models.MediaDeletion, error) {
+	tx := config.GetDB().Begin()
+
+	var deletions []models.MediaDeletion
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND next_attempt_at <= ?", models.MediaDeletionPending, time.Now()).
+		Order("next_attempt_at ASC").
+		Limit(100).
+		Find(&deletions).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if len(deletions) == 0 {
+		tx.Rollback()
+		return nil, nil
+	}
+
+	ids := make([]uuid.UUID, len(deletions))
+	for i := range deletions {
+		ids[i] = deletions[i].ID
+	}
+	if err := tx.Model(&models.MediaDeletion{}).Where("id IN ?", ids).
+		Update("next_attempt_at", time.Now().Add(mediaDeletionLease)).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return deletions, tx.Commit().Error
+}
+
+// mediaDeletionBackoff doubles the delay after every failed attempt, capped at a day
+func mediaDeletionBackoff(attempts int) time.Duration {
+	delay := time.Minute << uint(attempts-1)
+	if delay <= 0 || delay > 24*time.Hour {
+		delay = 24 * time.Hour
+	}
+	return delay
+}
+
+// processMediaDeletionsNow runs the deletion queue right away instead of waiting for the job
+func processMediaDeletionsNow() {
+	if err := ProcessMediaDeletions(); err != nil {
+		log.Printf("Failed to process media deletions: %v", err)
+	}
+}
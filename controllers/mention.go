@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"mentorship-backend/events"
+	"mentorship-backend/models"
+	"mentorship-backend/utils"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxMentions caps the number of users a single post or comment can mention
+const maxMentions = 20
+
+// mentionsOf limits a mentions query to those of a post's content, or of one of
+// its comments when commentID is set
+func mentionsOf(postID uuid.UUID, commentID *uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if commentID == nil {
+			return db.Where("post_id = ? AND comment_id IS NULL", postID)
+		}
+		return db.Where("post_id = ? AND comment_id = ?", postID, *commentID)
+	}
+}
+
+// syncMentions stores the users mentioned in a post or comment, replacing the
+// mentions of its previous version. Private users can only be mentioned by people
+// they follow, and blocked users not at all; other handles are left as plain text.
+func syncMentions(tx *gorm.DB, authorID, postID uuid.UUID, commentID *uuid.UUID, content string) error {
+	var handles []string
+	seen := make(map[string]bool)
+	for _, match := range utils.ParseMentions(content) {
+		handle := strings.ToLower(match.Username)
+		if seen[handle] {
+			continue
+		}
+		seen[handle] = true
+		handles = append(handles, handle)
+		if len(handles) == maxMentions {
+			break
+		}
+	}
+
+	var users []models.User
+	if len(handles) > 0 {
+		if err := tx.Where("lower(username) IN ? AND id <> ?", handles, authorID).Find(&users).Error; err != nil {
+			return err
+		}
+	}
+
+	allowed := make(map[uuid.UUID]bool, len(users))
+	for _, user := range users {
+		if (user.IsPrivate && !isFollowing(tx, user.ID, authorID)) || isBlocked(tx, &authorID, user.ID) {
+			continue
+		}
+		allowed[user.ID] = true
+	}
+
+	var existing []models.Mention
+	if err := tx.Scopes(mentionsOf(postID, commentID)).Find(&existing).Error; err != nil {
+		return err
+	}
+
+	var removed []uuid.UUID
+	for _, mention := range existing {
+		if allowed[mention.UserID] {
+			delete(allowed, mention.UserID)
+		} else {
+			removed = append(removed, mention.ID)
+		}
+	}
+	if len(removed) > 0 {
+		if err := tx.Where("id IN ?", removed).Delete(&models.Mention{}).Error; err != nil {
+			return err
+		}
+	}
+
+	added := make([]models.Mention, 0, len(allowed))
+	for userID := range allowed {
+		added = append(added, models.Mention{
+			UserID:    userID,
+			ActorID:   authorID,
+			PostID:    postID,
+			CommentID: commentID,
+		})
+	}
+	if len(added) == 0 {
+		return nil
+	}
+	return tx.Create(&added).Error
+}
+
+// emitMentions has the users mentioned in a published post, or in one of its
+// comments, notified once tx commits
+func emitMentions(tx *gorm.DB, post *models.Post, commentID *uuid.UUID) error {
+	if post.Status != models.PostStatusPublished {
+		return nil
+	}
+	return events.Emit(tx, events.PostMentioned{PostID: post.ID, CommentID: commentID})
+}
+
+// mentionTarget is a post or comment whose mention spans are being filled in
+type mentionTarget struct {
+	ID      uuid.UUID
+	Content string
+	Spans   *[]models.MentionSpan
+}
+
+// linkPostMentions fills in the mention spans of posts from their stored mentions
+func linkPostMentions(db *gorm.DB, posts ...*models.Post) error {
+	targets := make([]mentionTarget, len(posts))
+	for i, post := range posts {
+		targets[i] = mentionTarget{ID: post.ID, Content: post.Content, Spans: &post.Mentions}
+	}
+	return linkMentions(db.Where("mentions.comment_id IS NULL"), "mentions.post_id", targets)
+}
+
+// linkCommentMentions fills in the mention spans of comments from their stored mentions
+func linkCommentMentions(db *gorm.DB, comments ...*models.Comment) error {
+	targets := make([]mentionTarget, len(comments))
+	for i, comment := range comments {
+		targets[i] = mentionTarget{ID: comment.ID, Content: comment.Content, Spans: &comment.Mentions}
+	}
+	return linkMentions(db, "mentions.comment_id", targets)
+}
+
+// linkMentions turns the @handles of each target that match one of its stored
+// mentions into spans, using the mentioned users' current usernames
+func linkMentions(db *gorm.DB, column string, targets []mentionTarget) error {
+	ids := make([]uuid.UUID, 0, len(targets))
+	for _, target := range targets {
+		if target.Content != "" {
+			ids = append(ids, target.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var rows []struct {
+		TargetID uuid.UUID
+		UserID   uuid.UUID
+		Username string
+	}
+	if err := db.Table("mentions").
+		Select(column+" AS target_id, users.id AS user_id, users.username").
+		Joins("JOIN users ON users.id = mentions.user_id AND users.deleted_at IS NULL").
+		Where(column+" IN ?", ids).
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	mentioned := make(map[uuid.UUID]map[string]uuid.UUID)
+	for _, row := range rows {
+		if mentioned[row.TargetID] == nil {
+			mentioned[row.TargetID] = make(map[string]uuid.UUID)
+		}
+		mentioned[row.TargetID][strings.ToLower(row.Username)] = row.UserID
+	}
+
+	for _, target := range targets {
+		*target.Spans = nil
+		users := mentioned[target.ID]
+		if users == nil {
+			continue
+		}
+		for _, match := range utils.ParseMentions(target.Content) {
+			userID, ok := users[strings.ToLower(match.Username)]
+			if !ok {
+				continue
+			}
+			*target.Spans = append(*target.Spans, models.MentionSpan{
+				Start:    match.Start,
+				End:      match.End,
+				UserID:   userID,
+				Username: match.Username,
+			})
+		}
+	}
+	return nil
+}
@@ -67,19 +67,28 @@ func (mc *MentorController) GetMentorProfile(c *gin.Context) {
 	mentorID := c.Param("id")
 	
 	var mentorDetails models.MentorDetails
-	if err := config.GetDB().Preload("User").Preload("Tags").First(&mentorDetails, "id = ?", mentorID).Error; err != nil {
+	if err := config.GetDB().Preload("User").Preload("Tags").First(&mentorDetails, "id = ?", mentorID).Error; err != nil ||
+		isBlocked(config.GetDB(), viewerID(c), mentorDetails.UserID) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Mentor profile not found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, mentorDetails)
+	viewer := viewerID(c)
+	rel, err := getRelationship(config.GetDB(), viewer, mentorDetails.UserID, canViewProfile(config.GetDB(), &mentorDetails.User, viewer))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch mentor profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mentorProfile{MentorDetails: mentorDetails, relationship: rel})
 }
 
 // ListMentors lists all mentors with optional filters
 func (mc *MentorController) ListMentors(c *gin.Context) {
 	var mentors []models.MentorDetails
 	
-	query := config.GetDB().Preload("User").Preload("Tags")
+	query := config.GetDB().Preload("User").Preload("Tags").
+		Scopes(notBlocked(viewerID(c), "mentor_details.user_id"))
 	
 	// Add skill filter if provided
 	if skill := c.Query("skill"); skill != "" {
@@ -130,3 +139,110 @@ func (mc *MentorController) UpdateAvailability(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Availability updated successfully"})
 }
+
+// AddMentee offers to add a user to the current mentor's mentees. The user becomes a
+// mentee once they accept the offer.
+func (mc *MentorController) AddMentee(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var mentorDetails models.MentorDetails
+	if err := config.GetDB().Where("user_id = ?", userID).First(&mentorDetails).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only mentors can add mentees"})
+		return
+	}
+
+	menteeUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if menteeUUID == userID.(uuid.UUID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot mentor yourself"})
+		return
+	}
+
+	var mentee models.User
+	if err := config.GetDB().First(&mentee, "id = ?", menteeUUID).Error; err != nil ||
+		isBlocked(config.GetDB(), viewerID(c), mentee.ID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var existing models.Mentorship
+	if err := config.GetDB().Where("mentor_id = ? AND mentee_id = ?", userID, menteeUUID).First(&existing).Error; err == nil {
+		c.JSON(http.StatusOK, existing)
+		return
+	}
+
+	request, created, err := requestMentorship(userID.(uuid.UUID), &mentee)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send mentorship request"})
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusAccepted
+	}
+	c.JSON(status, gin.H{"message": "Mentorship request sent", "request": request})
+}
+
+// RemoveMentee removes a user from the current mentor's mentees
+func (mc *MentorController) RemoveMentee(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	menteeUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	result := config.GetDB().Where("mentor_id = ? AND mentee_id = ?", userID, menteeUUID).Delete(&models.Mentorship{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove mentee"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not your mentee"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Mentee removed successfully"})
+}
+
+// ListMentees lists the current mentor's mentees
+func (mc *MentorController) ListMentees(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var mentorships []models.Mentorship
+	if err := config.GetDB().Where("mentor_id = ?", userID).
+		Preload("Mentee").
+		Order("created_at DESC").
+		Find(&mentorships).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch mentees"})
+		return
+	}
+
+	mentees := make([]gin.H, len(mentorships))
+	for i, mentorship := range mentorships {
+		mentees[i] = gin.H{
+			"id":        mentorship.Mentee.ID,
+			"name":      mentorship.Mentee.Name,
+			"avatarURL": mentorship.Mentee.AvatarURL,
+			"since":     mentorship.CreatedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, mentees)
+}
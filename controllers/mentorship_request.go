@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"errors"
+	"mentorship-backend/config"
+	"mentorship-backend/events"
+	"mentorship-backend/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ListMentorshipRequests lists the pending offers to mentor the current user, oldest first
+func (mc *MentorController) ListMentorshipRequests(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	query := config.GetDB().Model(&models.MentorshipRequest{}).
+		Where("mentee_id = ? AND status = ?", userID, models.MentorshipRequestPending)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch mentorship requests"})
+		return
+	}
+
+	page := getPagination(c)
+	var requests []models.MentorshipRequest
+	if err := query.Preload("Mentor").
+		Order("created_at ASC").
+		Scopes(page.scope).
+		Find(&requests).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch mentorship requests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"requests": requests,
+		"page":     page.Page,
+		"limit":    page.Limit,
+		"total":    total,
+	})
+}
+
+// AcceptMentorshipRequest makes the current user a mentee of the requesting mentor
+func (mc *MentorController) AcceptMentorshipRequest(c *gin.Context) {
+	mc.respondToMentorshipRequest(c, models.MentorshipRequestAccepted)
+}
+
+// RejectMentorshipRequest turns down an offer to mentor the current user
+func (mc *MentorController) RejectMentorshipRequest(c *gin.Context) {
+	mc.respondToMentorshipRequest(c, models.MentorshipRequestRejected)
+}
+
+func (mc *MentorController) respondToMentorshipRequest(c *gin.Context, status string) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	tx := config.GetDB().Begin()
+
+	var request models.MentorshipRequest
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&request, "id = ? AND mentee_id = ? AND status = ?", c.Param("id"), userID, models.MentorshipRequestPending).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mentorship request not found"})
+		return
+	}
+
+	var err error
+	if status == models.MentorshipRequestAccepted {
+		err = acceptMentorshipRequest(tx, &request)
+	} else {
+		now := time.Now()
+		request.Status = models.MentorshipRequestRejected
+		request.RespondedAt = &now
+		err = tx.Model(&request).Select("Status", "RespondedAt").Updates(&request).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update mentorship request"})
+		return
+	}
+
+	tx.Commit()
+	c.JSON(http.StatusOK, request)
+}
+
+// requestMentorship offers to mentor a user. It reports whether a new request was
+// made, as opposed to one already pending.
+func requestMentorship(mentorID uuid.UUID, mentee *models.User) (*models.MentorshipRequest, bool, error) {
+	tx := config.GetDB().Begin()
+
+	var request models.MentorshipRequest
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&request, "mentor_id = ? AND mentee_id = ?", mentorID, mentee.ID).Error
+	switch {
+	case err == nil && request.Status == models.MentorshipRequestPending:
+		tx.Rollback()
+		return &request, false, nil
+	case err == nil:
+		// Offer again after a rejection, or after the mentorship ended
+		request.Status = models.MentorshipRequestPending
+		request.RespondedAt = nil
+		request.CreatedAt = time.Now()
+		err = tx.Model(&request).Select("Status", "RespondedAt", "CreatedAt").Updates(&request).Error
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		request = models.MentorshipRequest{MentorID: mentorID, MenteeID: mentee.ID}
+		err = tx.Create(&request).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, false, err
+	}
+
+	if err := events.Emit(tx, events.MentorshipRequested{RequestID: request.ID, MentorID: mentorID, MenteeID: mentee.ID}); err != nil {
+		tx.Rollback()
+		return nil, false, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, false, err
+	}
+	return &request, true, nil
+}
+
+// acceptMentorshipRequest makes the mentee a mentee of the mentor and lets the
+// mentor know
+func acceptMentorshipRequest(tx *gorm.DB, request *models.MentorshipRequest) error {
+	var count int64
+	if err := tx.Model(&models.Mentorship{}).
+		Where("mentor_id = ? AND mentee_id = ?", request.MentorID, request.MenteeID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		mentorship := models.Mentorship{MentorID: request.MentorID, MenteeID: request.MenteeID}
+		if err := tx.Create(&mentorship).Error; err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	request.Status = models.MentorshipRequestAccepted
+	request.RespondedAt = &now
+	if err := tx.Model(request).Select("Status", "RespondedAt").Updates(request).Error; err != nil {
+		return err
+	}
+
+	return events.Emit(tx, events.MentorshipRequestAccepted{RequestID: request.ID, MentorID: request.MentorID, MenteeID: request.MenteeID})
+}
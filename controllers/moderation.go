@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"mentorship-backend/config"
+	"mentorship-backend/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ModerationController struct{}
+
+func NewModerationController() *ModerationController {
+	return &ModerationController{}
+}
+
+// ListQuarantinedMedia lists the media flagged by the media scanner, oldest first
+func (mc *ModerationController) ListQuarantinedMedia(c *gin.Context) {
+	query := config.GetDB().Model(&models.PostMedia{}).
+		Where("moderation_status = ?", models.MediaModerationQuarantined)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch quarantined media"})
+		return
+	}
+
+	page := getPagination(c)
+	var media []models.PostMedia
+	if err := query.Order("created_at ASC").Scopes(page.scope).Find(&media).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch quarantined media"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"media": media,
+		"page":  page.Page,
+		"limit": page.Limit,
+		"total": total,
+	})
+}
+
+// ApproveMedia releases quarantined media so it is shown on its post
+func (mc *ModerationController) ApproveMedia(c *gin.Context) {
+	var media models.PostMedia
+	if err := config.GetDB().First(&media, "id = ? AND moderation_status = ?", c.Param("id"), models.MediaModerationQuarantined).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quarantined media not found"})
+		return
+	}
+
+	if err := config.GetDB().Model(&media).Update("moderation_status", models.MediaModerationApproved).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve media"})
+		return
+	}
+
+	c.JSON(http.StatusOK, media)
+}
+
+// RejectMedia removes quarantined media from its post and deletes the file
+func (mc *ModerationController) RejectMedia(c *gin.Context) {
+	var media models.PostMedia
+	if err := config.GetDB().First(&media, "id = ? AND moderation_status = ?", c.Param("id"), models.MediaModerationQuarantined).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quarantined media not found"})
+		return
+	}
+
+	tx := config.GetDB().Begin()
+	if err := tx.Delete(&media).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reject media"})
+		return
+	}
+	if err := enqueueMediaDeletion(tx, postMediaAssets([]models.PostMedia{media})); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reject media"})
+		return
+	}
+	tx.Commit()
+
+	go processMediaDeletionsNow()
+	c.JSON(http.StatusOK, gin.H{"message": "Media rejected"})
+}
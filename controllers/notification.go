@@ -1,11 +1,28 @@
 package controllers
 
 import (
+	"log"
 	"mentorship-backend/config"
 	"mentorship-backend/models"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultNotificationRetentionDays is how long read notifications are kept
+	// unless NOTIFICATION_RETENTION_DAYS says otherwise
+	defaultNotificationRetentionDays = 90
+	// maxBulkDeleteNotifications caps the notifications deleted by ID in one request
+	maxBulkDeleteNotifications = 100
+	// notificationCleanupBatch is how many notifications the cleanup job deletes per
+	// statement, so it never holds locks on many rows at once
+	notificationCleanupBatch = 1000
 )
 
 type NotificationController struct {}
@@ -14,12 +31,10 @@ func NewNotificationController() *NotificationController {
 	return &NotificationController{}
 }
 
-// CreateNotification creates a new notification
-func (nc *NotificationController) CreateNotification(notification *models.Notification) error {
-	return config.GetDB().Create(notification).Error
-}
-
-// GetNotifications gets notifications for a user
+// GetNotifications gets notifications for a user, most recent first. They can be
+// limited to unread ones with unread=true and to some types with a comma-separated
+// type parameter. The response is the page of notifications, with the number of
+// matching notifications in X-Total-Count and the user's unread count in X-Unread-Count.
 func (nc *NotificationController) GetNotifications(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -27,10 +42,32 @@ func (nc *NotificationController) GetNotifications(c *gin.Context) {
 		return
 	}
 
+	// Actions of blocked and muted users are left out
+	query := visibleNotifications(config.GetDB(), userID.(uuid.UUID))
+	if c.Query("unread") == "true" {
+		query = query.Where("notifications.is_read = ?", false)
+	}
+	if types := c.Query("type"); types != "" {
+		query = query.Where("notifications.type IN ?", strings.Split(types, ","))
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch notifications"})
+		return
+	}
+
+	unread, err := unreadCount(config.GetDB(), userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch unread count"})
+		return
+	}
+
+	page := getPagination(c)
 	var notifications []models.Notification
-	if err := config.GetDB().
-		Where("user_id = ?", userID).
+	if err := query.
 		Order("created_at DESC").
+		Scopes(page.scope).
 		Preload("User").
 		Preload("Actor").
 		Preload("Post").
@@ -39,31 +76,34 @@ func (nc *NotificationController) GetNotifications(c *gin.Context) {
 		return
 	}
 
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.Header("X-Unread-Count", strconv.FormatInt(unread, 10))
 	c.JSON(200, notifications)
 }
 
-// MarkAsRead marks a notification as read
+// MarkAsRead marks one of the current user's notifications as read
 func (nc *NotificationController) MarkAsRead(c *gin.Context) {
-	notifID := c.Param("id")
-	if notifID == "" {
-		c.JSON(400, gin.H{"error": "Notification ID is required"})
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(401, gin.H{"error": "User not authenticated"})
 		return
 	}
 
-	var notification models.Notification
-	if err := config.GetDB().First(&notification, notifID).Error; err != nil {
-		c.JSON(404, gin.H{"error": "Notification not found"})
+	notifID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid notification ID"})
 		return
 	}
 
-	userID, exists := c.Get("userID")
-	if !exists || notification.UserID != userID.(uuid.UUID) {
-		c.JSON(401, gin.H{"error": "Unauthorized"})
+	result := config.GetDB().Model(&models.Notification{}).
+		Where("id = ? AND user_id = ?", notifID, userID).
+		Update("is_read", true)
+	if result.Error != nil {
+		c.JSON(500, gin.H{"error": "Failed to mark notification as read"})
 		return
 	}
-
-	if err := config.GetDB().Model(&notification).Update("is_read", true).Error; err != nil {
-		c.JSON(500, gin.H{"error": "Failed to mark notification as read"})
+	if result.RowsAffected == 0 {
+		c.JSON(404, gin.H{"error": "Notification not found"})
 		return
 	}
 
@@ -87,3 +127,127 @@ func (nc *NotificationController) MarkAllAsRead(c *gin.Context) {
 
 	c.JSON(200, gin.H{"message": "All notifications marked as read"})
 }
+
+// DeleteNotification deletes one of the current user's notifications
+func (nc *NotificationController) DeleteNotification(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(401, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	notifID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid notification ID"})
+		return
+	}
+
+	result := config.GetDB().Unscoped().
+		Where("id = ? AND user_id = ?", notifID, userID).
+		Delete(&models.Notification{})
+	if result.Error != nil {
+		c.JSON(500, gin.H{"error": "Failed to delete notification"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(404, gin.H{"error": "Notification not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Notification deleted"})
+}
+
+// DeleteNotifications deletes several of the current user's notifications, either
+// the given ones or all that have been read. IDs of notifications that are gone
+// already are ignored.
+func (nc *NotificationController) DeleteNotifications(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(401, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req struct {
+		IDs     []uuid.UUID `json:"ids"`
+		AllRead bool        `json:"allRead"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := config.GetDB().Unscoped().Where("user_id = ?", userID)
+	switch {
+	case req.AllRead && len(req.IDs) == 0:
+		query = query.Where("is_read = ?", true)
+	case !req.AllRead && len(req.IDs) > 0 && len(req.IDs) <= maxBulkDeleteNotifications:
+		query = query.Where("id IN ?", req.IDs)
+	default:
+		c.JSON(400, gin.H{"error": "Either allRead or between 1 and 100 ids are required"})
+		return
+	}
+
+	result := query.Delete(&models.Notification{})
+	if result.Error != nil {
+		c.JSON(500, gin.H{"error": "Failed to delete notifications"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Notifications deleted",
+		"deleted": result.RowsAffected,
+	})
+}
+
+// CleanUpNotifications deletes read notifications older than the retention period,
+// and notifications whose post or actor has been deleted. It is run periodically
+// by the job runner.
+func CleanUpNotifications() error {
+	db := config.GetDB()
+	cutoff := time.Now().AddDate(0, 0, -notificationRetentionDays())
+
+	expired, err := deleteNotificationsInBatches(db,
+		"(is_read = ? AND updated_at < ?) OR deleted_at IS NOT NULL", true, cutoff)
+	if err != nil {
+		return err
+	}
+	orphaned, err := deleteNotificationsInBatches(db,
+		`(post_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM posts WHERE posts.id = notifications.post_id AND posts.deleted_at IS NULL))
+		OR NOT EXISTS (SELECT 1 FROM users WHERE users.id = notifications.actor_id AND users.deleted_at IS NULL)`)
+	if err != nil {
+		return err
+	}
+
+	if expired+orphaned > 0 {
+		log.Printf("Cleaned up %d expired and %d orphaned notifications", expired, orphaned)
+	}
+	return nil
+}
+
+// notificationRetentionDays is how many days read notifications are kept
+func notificationRetentionDays() int {
+	days, err := strconv.Atoi(os.Getenv("NOTIFICATION_RETENTION_DAYS"))
+	if err != nil || days <= 0 {
+		return defaultNotificationRetentionDays
+	}
+	return days
+}
+
+// deleteNotificationsInBatches deletes every notification matching the condition
+// and returns how many there were
+func deleteNotificationsInBatches(db *gorm.DB, condition string, args ...interface{}) (int64, error) {
+	var deleted int64
+	for {
+		result := db.Unscoped().
+			Where("id IN (?)", db.Unscoped().Model(&models.Notification{}).Select("id").
+				Where(condition, args...).Limit(notificationCleanupBatch)).
+			Delete(&models.Notification{})
+		if result.Error != nil {
+			return deleted, result.Error
+		}
+		deleted += result.RowsAffected
+		if result.RowsAffected < notificationCleanupBatch {
+			return deleted, nil
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"mentorship-backend/events"
+	"mentorship-backend/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RegisterNotificationBuilders subscribes the builders that turn events into
+// notifications. Builders run after the event's transaction has committed, so
+// they skip events whose subject has since been deleted.
+func RegisterNotificationBuilders() {
+	events.Subscribe(notifyUserFollowed)
+	events.Subscribe(notifyFollowRequested)
+	events.Subscribe(notifyFollowRequestApproved)
+	events.Subscribe(notifyMentorshipRequested)
+	events.Subscribe(notifyMentorshipRequestAccepted)
+	events.Subscribe(notifyPostPublished)
+	events.Subscribe(notifyPostLiked)
+	events.Subscribe(notifyPostShared)
+	events.Subscribe(notifyCommentCreated)
+	events.Subscribe(notifyCommentReacted)
+	events.Subscribe(notifyPostMentioned)
+}
+
+// notifyUserFollowed lets a user know they have a new follower. Followers the user
+// approved themselves are not announced.
+func notifyUserFollowed(tx *gorm.DB, event events.UserFollowed) error {
+	if event.ViaRequest {
+		return nil
+	}
+	follower, err := findActor(tx, event.FollowerID)
+	if follower == nil {
+		return err
+	}
+	return notify(tx, models.Notification{
+		UserID:  event.FollowingID,
+		ActorID: follower.ID,
+		Type:    models.NotificationTypeFollow,
+		Message: fmt.Sprintf("%s started following you", follower.Name),
+	})
+}
+
+// notifyFollowRequested lets a private user know someone asked to follow them
+func notifyFollowRequested(tx *gorm.DB, event events.FollowRequested) error {
+	requester, err := findActor(tx, event.RequesterID)
+	if requester == nil {
+		return err
+	}
+	return notify(tx, models.Notification{
+		UserID:  event.TargetID,
+		ActorID: requester.ID,
+		Type:    models.NotificationTypeFollowRequest,
+		Message: fmt.Sprintf("%s requested to follow you", requester.Name),
+	})
+}
+
+// notifyFollowRequestApproved lets the requester know they can now follow the user
+func notifyFollowRequestApproved(tx *gorm.DB, event events.FollowRequestApproved) error {
+	target, err := findActor(tx, event.TargetID)
+	if target == nil {
+		return err
+	}
+	return notify(tx, models.Notification{
+		UserID:  event.RequesterID,
+		ActorID: target.ID,
+		Type:    models.NotificationTypeFollowApproved,
+		Message: fmt.Sprintf("%s approved your follow request", target.Name),
+	})
+}
+
+// notifyMentorshipRequested lets a user know a mentor offered to mentor them
+func notifyMentorshipRequested(tx *gorm.DB, event events.MentorshipRequested) error {
+	mentor, err := findActor(tx, event.MentorID)
+	if mentor == nil {
+		return err
+	}
+	return notify(tx, models.Notification{
+		UserID:  event.MenteeID,
+		ActorID: mentor.ID,
+		Type:    models.NotificationTypeMentorshipRequest,
+		Message: fmt.Sprintf("%s offered to mentor you", mentor.Name),
+	})
+}
+
+// notifyMentorshipRequestAccepted lets the mentor know their offer was accepted
+func notifyMentorshipRequestAccepted(tx *gorm.DB, event events.MentorshipRequestAccepted) error {
+	mentee, err := findActor(tx, event.MenteeID)
+	if mentee == nil {
+		return err
+	}
+	return notify(tx, models.Notification{
+		UserID:  event.MentorID,
+		ActorID: mentee.ID,
+		Type:    models.NotificationTypeMentorshipAccepted,
+		Message: fmt.Sprintf("%s accepted your mentorship offer", mentee.Name),
+	})
+}
+
+// notifyPostPublished lets the author's followers in the post's audience know
+func notifyPostPublished(tx *gorm.DB, event events.PostPublished) error {
+	post, err := findEventPost(tx, event.PostID)
+	if post == nil || post.Status != models.PostStatusPublished {
+		return err
+	}
+	return notifyFollowersOfPost(tx, post)
+}
+
+// notifyPostLiked lets a post's author know someone liked it
+func notifyPostLiked(tx *gorm.DB, event events.PostLiked) error {
+	post, err := findEventPost(tx, event.PostID)
+	if post == nil || post.UserID == event.UserID {
+		return err
+	}
+	liker, err := findActor(tx, event.UserID)
+	if liker == nil {
+		return err
+	}
+	return notify(tx, models.Notification{
+		UserID:  post.UserID,
+		ActorID: liker.ID,
+		PostID:  &post.ID,
+		Type:    models.NotificationTypeLike,
+		Message: fmt.Sprintf("%s liked your post", liker.Name),
+	})
+}
+
+// notifyPostShared lets the original author know someone shared their post
+func notifyPostShared(tx *gorm.DB, event events.PostShared) error {
+	original, err := findEventPost(tx, event.OriginalPostID)
+	if original == nil || original.UserID == event.UserID {
+		return err
+	}
+	sharer, err := findActor(tx, event.UserID)
+	if sharer == nil {
+		return err
+	}
+
+	message := fmt.Sprintf("%s shared your post", sharer.Name)
+	if event.IsQuote {
+		message = fmt.Sprintf("%s quoted your post", sharer.Name)
+	}
+	return notify(tx, models.Notification{
+		UserID:  original.UserID,
+		ActorID: sharer.ID,
+		PostID:  &original.ID,
+		Type:    models.NotificationTypeShare,
+		Message: message,
+	})
+}
+
+// notifyCommentCreated lets the post's author know about a new comment, and the
+// parent comment's author about a reply. Nobody is notified of their own comments.
+func notifyCommentCreated(tx *gorm.DB, event events.CommentCreated) error {
+	post, err := findEventPost(tx, event.PostID)
+	if post == nil {
+		return err
+	}
+	commenter, err := findActor(tx, event.UserID)
+	if commenter == nil {
+		return err
+	}
+
+	var notifications []models.Notification
+	repliedTo := event.UserID
+	if event.ParentID != nil {
+		var parent models.Comment
+		err := tx.First(&parent, "id = ?", *event.ParentID).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil && !parent.IsTombstone() && parent.UserID != event.UserID &&
+			!isBlocked(tx, &parent.UserID, event.UserID) && canViewPost(tx, post, &parent.UserID) {
+			repliedTo = parent.UserID
+			notifications = append(notifications, models.Notification{
+				UserID:    parent.UserID,
+				ActorID:   commenter.ID,
+				PostID:    &post.ID,
+				CommentID: &event.CommentID,
+				Type:      models.NotificationTypeComment,
+				Message:   fmt.Sprintf("%s replied to your comment", commenter.Name),
+			})
+		}
+	}
+
+	// Authors replied to directly only get the reply notification
+	if post.UserID != event.UserID && post.UserID != repliedTo && !isBlocked(tx, &post.UserID, event.UserID) {
+		notifications = append(notifications, models.Notification{
+			UserID:    post.UserID,
+			ActorID:   commenter.ID,
+			PostID:    &post.ID,
+			CommentID: &event.CommentID,
+			Type:      models.NotificationTypeComment,
+			Message:   fmt.Sprintf("%s commented on your post", commenter.Name),
+		})
+	}
+	return notify(tx, notifications...)
+}
+
+// notifyCommentReacted lets a comment's author know someone reacted to it
+func notifyCommentReacted(tx *gorm.DB, event events.CommentReacted) error {
+	var comment models.Comment
+	err := tx.First(&comment, "id = ?", event.CommentID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return notifyCommentReaction(tx, &comment, event.UserID)
+}
+
+// notifyPostMentioned lets users mentioned in a post, or in one of its comments,
+// know about it once. Users who cannot see the post are not notified.
+func notifyPostMentioned(tx *gorm.DB, event events.PostMentioned) error {
+	post, err := findEventPost(tx, event.PostID)
+	if post == nil || post.Status != models.PostStatusPublished {
+		return err
+	}
+	if event.CommentID != nil {
+		var comment models.Comment
+		err := tx.First(&comment, "id = ?", *event.CommentID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if comment.IsTombstone() {
+			return nil
+		}
+	}
+
+	var mentions []models.Mention
+	if err := tx.Scopes(mentionsOf(post.ID, event.CommentID)).Where("notified_at IS NULL").Find(&mentions).Error; err != nil {
+		return err
+	}
+	if len(mentions) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(mentions))
+	for i, mention := range mentions {
+		ids[i] = mention.ID
+	}
+	actor, err := findActor(tx, mentions[0].ActorID)
+	if err != nil {
+		return err
+	}
+
+	if actor != nil {
+		message := fmt.Sprintf("%s mentioned you in a post", actor.Name)
+		if event.CommentID != nil {
+			message = fmt.Sprintf("%s mentioned you in a comment", actor.Name)
+		}
+
+		var notifications []models.Notification
+		for _, mention := range mentions {
+			if !canViewPost(tx, post, &mention.UserID) {
+				continue
+			}
+			notifications = append(notifications, models.Notification{
+				UserID:    mention.UserID,
+				ActorID:   actor.ID,
+				PostID:    &post.ID,
+				CommentID: event.CommentID,
+				Type:      models.NotificationTypeMention,
+				Message:   message,
+			})
+		}
+		if err := notify(tx, notifications...); err != nil {
+			return err
+		}
+	}
+
+	return tx.Model(&models.Mention{}).Where("id IN ?", ids).Update("notified_at", time.Now()).Error
+}
+
+// findActor loads the user behind an event, returning nil without an error if
+// they have been deleted since
+func findActor(tx *gorm.DB, userID uuid.UUID) (*models.User, error) {
+	var user models.User
+	err := tx.First(&user, "id = ?", userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// findEventPost loads the post an event is about, returning nil without an error
+// if it has been deleted since
+func findEventPost(tx *gorm.DB, postID uuid.UUID) (*models.Post, error) {
+	var post models.Post
+	err := tx.First(&post, "id = ?", postID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
@@ -0,0 +1,298 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"mentorship-backend/config"
+	"mentorship-backend/models"
+	"mentorship-backend/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxDigestNotifications caps the notifications listed in one digest email
+const maxDigestNotifications = 50
+
+// digestPeriods is how often each digest frequency sends an email
+var digestPeriods = map[string]time.Duration{
+	models.DigestDaily:  24 * time.Hour,
+	models.DigestWeekly: 7 * 24 * time.Hour,
+}
+
+// GetNotificationPreferences returns how the current user receives each type of
+// notification, which types are pushed to their devices, and their digest frequency
+func (nc *NotificationController) GetNotificationPreferences(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	respondNotificationPreferences(c, userID.(uuid.UUID))
+}
+
+// UpdateNotificationPreferences changes how the current user receives the given
+// notification types, whether they are pushed, and how often the user gets a
+// digest. Types left out keep their current settings.
+func (nc *NotificationController) UpdateNotificationPreferences(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var updateData struct {
+		Preferences     map[string]string `json:"preferences"` // Notification type to channel
+		Push            map[string]bool   `json:"push"`        // Notification type to whether it is pushed
+		DigestFrequency *string           `json:"digestFrequency"`
+	}
+	if err := c.ShouldBindJSON(&updateData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	preferences := make([]models.NotificationPreference, 0, len(updateData.Preferences))
+	for notificationType, channel := range updateData.Preferences {
+		if !models.IsValidNotificationType(notificationType) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown notification type %q", notificationType)})
+			return
+		}
+		if !models.IsValidNotificationChannel(channel) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid channel %q", channel)})
+			return
+		}
+		preferences = append(preferences, models.NotificationPreference{
+			UserID:  userID.(uuid.UUID),
+			Type:    notificationType,
+			Channel: channel,
+		})
+	}
+	pushPreferences := make([]models.NotificationPreference, 0, len(updateData.Push))
+	for notificationType, enabled := range updateData.Push {
+		if !models.IsPushNotificationType(notificationType) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Notifications of type %q are not pushed", notificationType)})
+			return
+		}
+		pushPreferences = append(pushPreferences, models.NotificationPreference{
+			UserID:       userID.(uuid.UUID),
+			Type:         notificationType,
+			Channel:      models.NotificationChannelInApp, // Only used if the type had no preference yet
+			PushDisabled: !enabled,
+		})
+	}
+	if updateData.DigestFrequency != nil {
+		if _, ok := digestPeriods[*updateData.DigestFrequency]; !ok && *updateData.DigestFrequency != models.DigestOff {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid digest frequency %q", *updateData.DigestFrequency)})
+			return
+		}
+	}
+
+	tx := config.GetDB().Begin()
+	if len(preferences) > 0 {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "type"}},
+			DoUpdates: clause.AssignmentColumns([]string{"channel"}),
+		}).Create(&preferences).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification preferences"})
+			return
+		}
+	}
+	if len(pushPreferences) > 0 {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "type"}},
+			DoUpdates: clause.AssignmentColumns([]string{"push_disabled"}),
+		}).Create(&pushPreferences).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification preferences"})
+			return
+		}
+	}
+
+	settings := models.NotificationSettings{UserID: userID.(uuid.UUID)}
+	if updateData.DigestFrequency != nil {
+		settings.DigestFrequency = *updateData.DigestFrequency
+	}
+	onConflict := clause.OnConflict{DoNothing: true}
+	if updateData.DigestFrequency != nil {
+		onConflict = clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"digest_frequency", "updated_at"}),
+		}
+	}
+	if err := tx.Clauses(onConflict).Create(&settings).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification settings"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification preferences"})
+		return
+	}
+	respondNotificationPreferences(c, userID.(uuid.UUID))
+}
+
+// respondNotificationPreferences writes the channel of every notification type,
+// defaulting to in-app, whether each push type is pushed, and the user's digest
+// frequency
+func respondNotificationPreferences(c *gin.Context, userID uuid.UUID) {
+	var preferences []models.NotificationPreference
+	if err := config.GetDB().Where("user_id = ?", userID).Find(&preferences).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notification preferences"})
+		return
+	}
+
+	settings := models.NotificationSettings{DigestFrequency: models.DigestDaily}
+	if err := config.GetDB().Where("user_id = ?", userID).Limit(1).Find(&settings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notification settings"})
+		return
+	}
+
+	channels := make(map[string]string, len(models.NotificationTypes))
+	for _, notificationType := range models.NotificationTypes {
+		channels[notificationType] = models.NotificationChannelInApp
+	}
+	push := make(map[string]bool, len(models.PushNotificationTypes))
+	for _, notificationType := range models.PushNotificationTypes {
+		push[notificationType] = true
+	}
+	for _, preference := range preferences {
+		channels[preference.Type] = preference.Channel
+		if models.IsPushNotificationType(preference.Type) {
+			push[preference.Type] = !preference.PushDisabled
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"preferences":     channels,
+		"push":            push,
+		"digestFrequency": settings.DigestFrequency,
+	})
+}
+
+// SendNotificationDigests emails users whose digest is due a summary of the unread
+// notifications they chose to receive by email. Digests are claimed in a short
+// transaction and sent outside of it, so a slow mail server holds no locks and a
+// failure only affects its own digest. It is run periodically by the job runner.
+func SendNotificationDigests() error {
+	now := time.Now()
+	due, err := claimNotificationDigests(now)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for i := range due {
+		settings := &due[i]
+		if err := sendDigest(config.GetDB(), settings, now); err != nil {
+			failed++
+			log.Printf("Failed to send notification digest to user %s: %v", settings.UserID, err)
+			// Release the claim so the digest is retried on the next run
+			if err := config.GetDB().Model(&models.NotificationSettings{}).
+				Where("user_id = ? AND digest_sent_at = ?", settings.UserID, now).
+				Update("digest_sent_at", settings.DigestSentAt).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	if failed > 0 {
+		log.Printf("Failed to send %d of %d notification digests", failed, len(due))
+	}
+	return nil
+}
+
+// claimNotificationDigests picks the settings of users whose digest is due and marks
+// their digest as sent at now, so no other instance sends it too. The returned
+// settings keep the previous DigestSentAt.
+func claimNotificationDigests(now time.Time) ([]models.NotificationSettings, error) {
+	tx := config.GetDB().Begin()
+
+	// Only users who chose email for some type can have anything to send
+	var due []models.NotificationSettings
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("(digest_frequency = ? AND (digest_sent_at IS NULL OR digest_sent_at <= ?)) OR (digest_frequency = ? AND (digest_sent_at IS NULL OR digest_sent_at <= ?))",
+			models.DigestDaily, now.Add(-digestPeriods[models.DigestDaily]),
+			models.DigestWeekly, now.Add(-digestPeriods[models.DigestWeekly])).
+		Where("EXISTS (SELECT 1 FROM notification_preferences WHERE notification_preferences.user_id = notification_settings.user_id AND notification_preferences.channel = ?)",
+			models.NotificationChannelEmail).
+		Order("digest_sent_at ASC NULLS FIRST").
+		Limit(100).
+		Find(&due).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if len(due) == 0 {
+		tx.Rollback()
+		return nil, nil
+	}
+
+	userIDs := make([]uuid.UUID, len(due))
+	for i := range due {
+		userIDs[i] = due[i].UserID
+	}
+	if err := tx.Model(&models.NotificationSettings{}).Where("user_id IN ?", userIDs).
+		Update("digest_sent_at", now).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return due, tx.Commit().Error
+}
+
+// sendDigest emails a user their unread notifications of email types since their
+// last digest. Nothing is sent when there are none.
+func sendDigest(db *gorm.DB, settings *models.NotificationSettings, now time.Time) error {
+	var user models.User
+	if err := db.First(&user, "id = ?", settings.UserID).Error; err != nil {
+		return err
+	}
+	if user.Email == "" || !user.IsActive {
+		return nil
+	}
+
+	since := now.Add(-digestPeriods[settings.DigestFrequency])
+	if settings.DigestSentAt != nil && settings.DigestSentAt.After(since) {
+		since = *settings.DigestSentAt
+	}
+
+	query := visibleNotifications(db, user.ID).
+		Where("notifications.is_read = ? AND notifications.created_at > ?", false, since).
+		Where("notifications.type IN (?)", db.Model(&models.NotificationPreference{}).
+			Select("type").Where("user_id = ? AND channel = ?", user.ID, models.NotificationChannelEmail))
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return err
+	}
+	if total == 0 {
+		return nil
+	}
+
+	var notifications []models.Notification
+	if err := query.Order("notifications.created_at DESC").Limit(maxDigestNotifications).Find(&notifications).Error; err != nil {
+		return err
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hi %s,\n\nHere is what happened while you were away:\n\n", user.Name)
+	for _, notification := range notifications {
+		fmt.Fprintf(&body, "- %s (%s)\n", notification.Message, notification.CreatedAt.Format("Jan 2, 15:04"))
+	}
+	if remaining := total - int64(len(notifications)); remaining > 0 {
+		fmt.Fprintf(&body, "\n...and %d more.\n", remaining)
+	}
+	body.WriteString("\nYou can change which notifications you get by email in your notification settings.\n")
+
+	subject := fmt.Sprintf("You have %d unread notifications", total)
+	if total == 1 {
+		subject = "You have 1 unread notification"
+	}
+	return utils.GetMailer().Send(user.Email, subject, body.String())
+}
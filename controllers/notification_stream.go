@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"mentorship-backend/config"
+	"mentorship-backend/models"
+	"mentorship-backend/realtime"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// streamHeartbeat is how often an idle stream sends a comment, so proxies don't
+// close the connection
+const streamHeartbeat = 25 * time.Second
+
+// streamTicketTTL is how long a stream ticket can be used after it was issued
+const streamTicketTTL = 30 * time.Second
+
+// CreateStreamTicket issues a single-use ticket for opening the notification
+// stream, so clients that cannot set headers never put their access token in a URL
+func (nc *NotificationController) CreateStreamTicket(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create stream ticket"})
+		return
+	}
+	ticket := hex.EncodeToString(secret)
+
+	streamTicket := models.StreamTicket{
+		TicketHash: models.HashStreamTicket(ticket),
+		UserID:     userID.(uuid.UUID),
+		ExpiresAt:  time.Now().Add(streamTicketTTL),
+	}
+	if expiresAt, ok := c.Get("tokenExpiresAt"); ok {
+		tokenExpiresAt := expiresAt.(time.Time)
+		streamTicket.TokenExpiresAt = &tokenExpiresAt
+	}
+
+	// Unused tickets are cleared out as new ones are issued
+	db := config.GetDB()
+	if err := db.Where("expires_at < ?", time.Now()).Delete(&models.StreamTicket{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create stream ticket"})
+		return
+	}
+	if err := db.Create(&streamTicket).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create stream ticket"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"ticket":    ticket,
+		"expiresAt": streamTicket.ExpiresAt,
+	})
+}
+
+// StreamNotifications pushes the current user's new notifications and unread count
+// as Server-Sent Events. The stream starts with the unread count and closes when
+// the access token expires, so clients reconnect with a fresh one.
+func (nc *NotificationController) StreamNotifications(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	viewer := userID.(uuid.UUID)
+
+	// Subscribe before counting so nothing slips in between
+	events, unsubscribe := realtime.GetHub().Subscribe(viewer)
+	defer unsubscribe()
+
+	unread, err := unreadCount(config.GetDB(), viewer)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch unread count"})
+		return
+	}
+
+	var expired <-chan time.Time
+	if expiresAt, ok := c.Get("tokenExpiresAt"); ok {
+		timer := time.NewTimer(time.Until(expiresAt.(time.Time)))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	c.SSEvent("unread", gin.H{"count": unread})
+	c.Writer.Flush()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-expired:
+			c.SSEvent("expired", gin.H{"message": "Access token expired"})
+			c.Writer.Flush()
+			return
+		case <-heartbeat.C:
+			c.Writer.WriteString(": ping\n\n")
+			c.Writer.Flush()
+		case event := <-events:
+			if event.Type == realtime.EventCreated && event.NotificationID != nil {
+				var notification models.Notification
+				if err := visibleNotifications(config.GetDB(), viewer).
+					Preload("Actor").
+					Preload("Post").
+					First(&notification, "notifications.id = ?", *event.NotificationID).Error; err == nil {
+					c.SSEvent("notification", notification)
+				}
+			}
+
+			count, err := unreadCount(config.GetDB(), viewer)
+			if err != nil {
+				return
+			}
+			if count != unread || event.Type == realtime.EventResync {
+				unread = count
+				c.SSEvent("unread", gin.H{"count": unread})
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// visibleNotifications queries the user's notifications, leaving out the actions
+// of users they blocked, were blocked by or muted
+func visibleNotifications(db *gorm.DB, userID uuid.UUID) *gorm.DB {
+	return db.Model(&models.Notification{}).
+		Where("notifications.user_id = ?", userID).
+		Scopes(notBlocked(&userID, "notifications.actor_id"), notMuted(&userID, "notifications.actor_id"))
+}
+
+// unreadCount counts the user's visible unread notifications
+func unreadCount(db *gorm.DB, userID uuid.UUID) (int64, error) {
+	var count int64
+	err := visibleNotifications(db, userID).Where("notifications.is_read = ?", false).Count(&count).Error
+	return count, err
+}
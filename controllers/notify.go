@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"mentorship-backend/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// notificationGroupWindow is how long an unread notification keeps absorbing
+// similar ones into its group
+const notificationGroupWindow = 6 * time.Hour
+
+// preferenceLookupBatch caps the recipients whose preferences are loaded per query
+const preferenceLookupBatch = 1000
+
+// groupedMessages are the messages of grouped notifications, given the latest
+// actor's name and how many others there are
+var groupedMessages = map[string]string{
+	models.NotificationTypeFollow:          "%s and %s started following you",
+	models.NotificationTypeLike:            "%s and %s liked your post",
+	models.NotificationTypeShare:           "%s and %s shared your post",
+	models.NotificationTypeCommentReaction: "%s and %s reacted to your comment",
+}
+
+type preferenceKey struct {
+	UserID uuid.UUID
+	Type   string
+}
+
+// notify delivers notifications according to their recipients' preferences.
+// Notifications of a grouped type are folded into a recent unread notification of
+// the same kind when there is one. Notifications of push types are queued to be
+// pushed to the recipient's devices once tx commits.
+func notify(tx *gorm.DB, notifications ...models.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	preferences, err := notificationPreferences(tx, notifications)
+	if err != nil {
+		return err
+	}
+	pushed := func(notification *models.Notification) bool {
+		return models.IsPushNotificationType(notification.Type) &&
+			!preferences[preferenceKey{notification.UserID, notification.Type}].PushDisabled
+	}
+
+	var created []models.Notification
+	var pushes []models.PushDelivery
+	for _, notification := range notifications {
+		if preferences[preferenceKey{notification.UserID, notification.Type}].Channel == models.NotificationChannelOff {
+			continue
+		}
+		if _, ok := groupedMessages[notification.Type]; ok {
+			group, changed, err := groupNotification(tx, &notification)
+			if err != nil {
+				return err
+			}
+			if changed && pushed(group) {
+				pushes = append(pushes, models.PushDelivery{NotificationID: group.ID})
+			}
+			if group != nil {
+				continue
+			}
+		}
+		notification.ActorCount = 1
+		created = append(created, notification)
+	}
+	if len(created) > 0 {
+		if err := tx.Omit(clause.Associations).CreateInBatches(&created, 100).Error; err != nil {
+			return err
+		}
+	}
+	for i := range created {
+		if pushed(&created[i]) {
+			pushes = append(pushes, models.PushDelivery{NotificationID: created[i].ID})
+		}
+	}
+	if len(pushes) > 0 {
+		if err := tx.CreateInBatches(&pushes, 100).Error; err != nil {
+			return err
+		}
+	}
+
+	var actors []models.NotificationActor
+	for _, notification := range created {
+		if _, ok := groupedMessages[notification.Type]; ok {
+			actors = append(actors, models.NotificationActor{NotificationID: notification.ID, ActorID: notification.ActorID})
+		}
+	}
+	if len(actors) == 0 {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&actors).Error
+}
+
+// notificationPreferences looks up how the recipients want to receive notifications
+// of the given types. Missing entries mean the notification is shown in the app
+// and pushed if it is of a push type.
+func notificationPreferences(tx *gorm.DB, notifications []models.Notification) (map[preferenceKey]models.NotificationPreference, error) {
+	seenUsers := make(map[uuid.UUID]bool)
+	seenTypes := make(map[string]bool)
+	var userIDs []uuid.UUID
+	var types []string
+	for _, notification := range notifications {
+		if !seenUsers[notification.UserID] {
+			seenUsers[notification.UserID] = true
+			userIDs = append(userIDs, notification.UserID)
+		}
+		if !seenTypes[notification.Type] {
+			seenTypes[notification.Type] = true
+			types = append(types, notification.Type)
+		}
+	}
+
+	preferences := make(map[preferenceKey]models.NotificationPreference)
+	for start := 0; start < len(userIDs); start += preferenceLookupBatch {
+		end := min(start+preferenceLookupBatch, len(userIDs))
+
+		var batch []models.NotificationPreference
+		if err := tx.Where("user_id IN ? AND type IN ?", userIDs[start:end], types).Find(&batch).Error; err != nil {
+			return nil, err
+		}
+		for _, preference := range batch {
+			preferences[preferenceKey{preference.UserID, preference.Type}] = preference
+		}
+	}
+	return preferences, nil
+}
+
+// groupNotification adds the notification's actor to a recent unread notification
+// of the same kind. It returns that group, or nil if there was none, and whether
+// the actor was new to it.
+func groupNotification(tx *gorm.DB, notification *models.Notification) (*models.Notification, bool, error) {
+	var group models.Notification
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND type = ? AND is_read = ? AND created_at > ?",
+			notification.UserID, notification.Type, false, time.Now().Add(-notificationGroupWindow)).
+		Where("post_id IS NOT DISTINCT FROM ? AND comment_id IS NOT DISTINCT FROM ?", notification.PostID, notification.CommentID).
+		Order("created_at DESC").
+		First(&group).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Notifications from before grouping have no actors recorded yet
+	actors := []models.NotificationActor{
+		{NotificationID: group.ID, ActorID: group.ActorID},
+		{NotificationID: group.ID, ActorID: notification.ActorID},
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&actors).Error; err != nil {
+		return nil, false, err
+	}
+
+	var actorCount int64
+	if err := tx.Model(&models.NotificationActor{}).Where("notification_id = ?", group.ID).Count(&actorCount).Error; err != nil {
+		return nil, false, err
+	}
+	if int(actorCount) == group.ActorCount {
+		// The same users acting again
+		return &group, false, nil
+	}
+
+	var actor models.User
+	if err := tx.Select("name").First(&actor, "id = ?", notification.ActorID).Error; err != nil {
+		return nil, false, err
+	}
+
+	group.ActorID = notification.ActorID
+	group.ActorCount = int(actorCount)
+	group.Message = groupedMessage(notification.Type, actor.Name, group.ActorCount-1)
+	group.CreatedAt = time.Now()
+	if err := tx.Model(&group).Select("ActorID", "ActorCount", "Message", "CreatedAt").Updates(&group).Error; err != nil {
+		return nil, false, err
+	}
+	return &group, true, nil
+}
+
+// groupedMessage describes a grouped notification, e.g. "Ana and 12 others liked your post"
+func groupedMessage(notificationType string, actorName string, others int) string {
+	count := "1 other"
+	if others > 1 {
+		count = fmt.Sprintf("%d others", others)
+	}
+	return fmt.Sprintf(groupedMessages[notificationType], actorName, count)
+}
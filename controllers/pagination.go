@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type pagination struct {
+	Page  int
+	Limit int
+}
+
+// getPagination reads the page and limit query parameters, falling back to sane defaults
+func getPagination(c *gin.Context) pagination {
+	page, err := strconv.Atoi(c.Query("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit < 1 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	return pagination{Page: page, Limit: limit}
+}
+
+// scope applies the page to a query
+func (p pagination) scope(db *gorm.DB) *gorm.DB {
+	return db.Offset((p.Page - 1) * p.Limit).Limit(p.Limit)
+}
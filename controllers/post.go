@@ -1,15 +1,22 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
 	"mentorship-backend/config"
+	"mentorship-backend/events"
 	"mentorship-backend/models"
 	"mentorship-backend/utils"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"log"
 )
 
@@ -19,6 +26,20 @@ func NewPostController() *PostController {
 	return &PostController{}
 }
 
+// maxMediaPerPost caps the number of files attached to a single post
+const maxMediaPerPost = 10
+
+// createPostRequest is the body of CreatePost. It is sent as JSON, or as
+// multipart/form-data with one or more "media" files attached.
+type createPostRequest struct {
+	Content     string     `json:"content" form:"content"`
+	Status      string     `json:"status" form:"status"`
+	PublishAt   *time.Time `json:"publishAt" form:"publishAt" time_format:"2006-01-02T15:04:05Z07:00"`
+	Visibility  string     `json:"visibility" form:"visibility"`
+	AudienceIDs []string   `json:"audienceIds" form:"audienceIds"`
+	AltTexts    []string   `json:"-" form:"altText"` // Alt text of each media file, in the same order
+}
+
 // CreatePost creates a new post
 func (pc *PostController) CreatePost(c *gin.Context) {
 	userID, exists := c.Get("userID")
@@ -27,36 +48,548 @@ func (pc *PostController) CreatePost(c *gin.Context) {
 		return
 	}
 
-	var post models.Post
-	if err := c.ShouldBindJSON(&post); err != nil {
+	var req createPostRequest
+	if err := c.ShouldBind(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Handle file upload if present
-	file, err := c.FormFile("image")
-	if err == nil && file != nil {
-		// Upload to Cloudinary
-		url, err := utils.UploadImage(file, "posts")
+	audienceIDs, err := parseUUIDs(req.AudienceIDs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid audience ID"})
+		return
+	}
+
+	post := models.Post{
+		UserID:      userID.(uuid.UUID),
+		Content:     req.Content,
+		Visibility:  req.Visibility,
+		AudienceIDs: audienceIDs,
+	}
+	if err := applyPostStatus(&post, req.Status, req.PublishAt); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validatePostVisibility(post.Visibility, post.AudienceIDs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Validate every attached file before uploading any of them
+	var files []*multipart.FileHeader
+	if form, err := c.MultipartForm(); err == nil {
+		files = form.File["media"]
+	}
+	if len(files) > maxMediaPerPost {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A post can have at most %d media files", maxMediaPerPost)})
+		return
+	}
+
+	infos := make([]*utils.MediaInfo, len(files))
+	for i, file := range files {
+		info, err := utils.InspectMedia(file)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		infos[i] = info
+	}
+	for _, altText := range req.AltTexts {
+		if len(altText) > maxAltTextLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Alt text cannot exceed %d characters", maxAltTextLength)})
 			return
 		}
-		
-		// Add the URL to the post's media URLs
-		post.MediaURLs = append(post.MediaURLs, url)
 	}
 
-	post.UserID = userID.(uuid.UUID)
+	media, err := uploadPostMedia(files, infos, req.AltTexts)
+	if errors.Is(err, utils.ErrMediaRejected) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload media"})
+		return
+	}
+	post.Media = media
 
-	if err := config.GetDB().Create(&post).Error; err != nil {
+	tx := config.GetDB().Begin()
+	if err := tx.Create(&post).Error; err != nil {
+		tx.Rollback()
+		go deleteStoredMedia(media)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create post"})
 		return
 	}
 
+	if err := setPostAudience(tx, &post, post.AudienceIDs); err != nil {
+		tx.Rollback()
+		go deleteStoredMedia(media)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set post audience"})
+		return
+	}
+
+	if err := syncMentions(tx, post.UserID, post.ID, nil, post.Content); err != nil {
+		tx.Rollback()
+		go deleteStoredMedia(media)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save mentions"})
+		return
+	}
+
+	if err := syncHashtags(tx, &post); err != nil {
+		tx.Rollback()
+		go deleteStoredMedia(media)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save hashtags"})
+		return
+	}
+
+	if post.Status == models.PostStatusPublished {
+		if err := adjustPostCount(tx, post.UserID, 1); err != nil {
+			tx.Rollback()
+			go deleteStoredMedia(media)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update post count"})
+			return
+		}
+		if err := events.Emit(tx, events.PostPublished{PostID: post.ID, AuthorID: post.UserID}); err != nil {
+			tx.Rollback()
+			go deleteStoredMedia(media)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to notify followers"})
+			return
+		}
+		if err := emitMentions(tx, &post, nil); err != nil {
+			tx.Rollback()
+			go deleteStoredMedia(media)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to notify mentioned users"})
+			return
+		}
+	}
+
+	tx.Commit()
+	config.GetDB().Model(&post).Association("Tags").Find(&post.Tags)
+	linkPostMentions(config.GetDB(), &post)
 	c.JSON(http.StatusCreated, post)
 }
 
+// UpdatePost edits a post. Drafts and scheduled posts can also be rescheduled or published.
+func (pc *PostController) UpdatePost(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var updateData struct {
+		Content     *string     `json:"content"`
+		Status      string      `json:"status"`
+		PublishAt   *time.Time  `json:"publishAt"`
+		Visibility  string      `json:"visibility"`
+		AudienceIDs []uuid.UUID `json:"audienceIds"`
+		// Media lists the post's media in their new order; media left out are removed
+		Media []struct {
+			ID      uuid.UUID `json:"id" binding:"required"`
+			AltText string    `json:"altText"`
+		} `json:"media"`
+	}
+	if err := c.ShouldBindJSON(&updateData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	postID := c.Param("id")
+	var post models.Post
+	if err := config.GetDB().First(&post, "id = ?", postID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	// Verify post ownership
+	if post.UserID != userID.(uuid.UUID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not authorized to modify this post"})
+		return
+	}
+
+	if updateData.Content != nil {
+		post.Content = *updateData.Content
+	}
+
+	var keptMedia, removedMedia []models.PostMedia
+	if updateData.Media != nil {
+		var existingMedia []models.PostMedia
+		if err := config.GetDB().Where("post_id = ?", post.ID).Find(&existingMedia).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch post media"})
+			return
+		}
+
+		byID := make(map[uuid.UUID]models.PostMedia, len(existingMedia))
+		for _, media := range existingMedia {
+			byID[media.ID] = media
+		}
+
+		for i, item := range updateData.Media {
+			media, ok := byID[item.ID]
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown media ID " + item.ID.String()})
+				return
+			}
+			if len(item.AltText) > maxAltTextLength {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Alt text cannot exceed %d characters", maxAltTextLength)})
+				return
+			}
+			media.Position = i
+			media.AltText = item.AltText
+			keptMedia = append(keptMedia, media)
+			delete(byID, item.ID)
+		}
+		for _, media := range byID {
+			removedMedia = append(removedMedia, media)
+		}
+	}
+
+	audienceChanged := updateData.Visibility != "" || updateData.AudienceIDs != nil
+	if audienceChanged {
+		if updateData.Visibility != "" {
+			post.Visibility = updateData.Visibility
+		}
+		if err := validatePostVisibility(post.Visibility, updateData.AudienceIDs); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	wasPublished := post.Status == models.PostStatusPublished
+	if updateData.Status != "" || updateData.PublishAt != nil {
+		if wasPublished {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Published posts cannot be rescheduled"})
+			return
+		}
+
+		status := updateData.Status
+		if status == "" {
+			status = post.Status
+		}
+		if err := applyPostStatus(&post, status, updateData.PublishAt); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	tx := config.GetDB().Begin()
+	if err := tx.Save(&post).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update post"})
+		return
+	}
+
+	if audienceChanged {
+		if err := setPostAudience(tx, &post, updateData.AudienceIDs); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set post audience"})
+			return
+		}
+	}
+
+	for i := range keptMedia {
+		if err := tx.Model(&keptMedia[i]).Select("position", "alt_text").Updates(&keptMedia[i]).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update post media"})
+			return
+		}
+	}
+	for i := range removedMedia {
+		if err := tx.Delete(&removedMedia[i]).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove post media"})
+			return
+		}
+	}
+	if err := enqueueMediaDeletion(tx, postMediaAssets(removedMedia)); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue media deletion"})
+		return
+	}
+
+	if updateData.Content != nil {
+		if err := syncMentions(tx, post.UserID, post.ID, nil, post.Content); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save mentions"})
+			return
+		}
+		if err := syncHashtags(tx, &post); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save hashtags"})
+			return
+		}
+	}
+
+	if !wasPublished && post.Status == models.PostStatusPublished {
+		if err := adjustPostCount(tx, post.UserID, 1); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update post count"})
+			return
+		}
+		if err := events.Emit(tx, events.PostPublished{PostID: post.ID, AuthorID: post.UserID}); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to notify followers"})
+			return
+		}
+	}
+
+	// Users newly mentioned in an edit are notified as well
+	if err := emitMentions(tx, &post, nil); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to notify mentioned users"})
+		return
+	}
+
+	tx.Commit()
+
+	if len(removedMedia) > 0 {
+		go processMediaDeletionsNow()
+	}
+
+	config.GetDB().Preload("Tags").Preload("Media", orderedMedia).First(&post, "id = ?", post.ID)
+	linkPostMentions(config.GetDB(), &post)
+	c.JSON(http.StatusOK, post)
+}
+
+// ListDrafts lists the current user's drafts and scheduled posts
+func (pc *PostController) ListDrafts(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	query := config.GetDB().Preload("Tags").
+		Preload("Media", orderedMedia).
+		Where("user_id = ?", userID)
+
+	if status := c.Query("status"); status != "" {
+		if status != models.PostStatusDraft && status != models.PostStatusScheduled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Status must be draft or scheduled"})
+			return
+		}
+		query = query.Where("status = ?", status)
+	} else {
+		query = query.Where("status IN ?", []string{models.PostStatusDraft, models.PostStatusScheduled})
+	}
+
+	var posts []models.Post
+	if err := query.Order("publish_at ASC NULLS LAST, updated_at DESC").Find(&posts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch drafts"})
+		return
+	}
+	if err := linkPostMentions(config.GetDB(), postPointers(posts)...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch drafts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, posts)
+}
+
+// PublishDuePosts publishes scheduled posts whose publish time has passed and
+// notifies the authors' followers. It is run periodically by the job runner.
+func PublishDuePosts() error {
+	var posts []models.Post
+	tx := config.GetDB().Begin()
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND publish_at <= ?", models.PostStatusScheduled, time.Now()).
+		Order("publish_at ASC").
+		Limit(100).
+		Find(&posts).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for i := range posts {
+		post := &posts[i]
+		if err := applyPostStatus(post, models.PostStatusPublished, nil); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Model(post).Select("status", "publish_at", "published_at").Updates(post).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := adjustPostCount(tx, post.UserID, 1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := events.Emit(tx, events.PostPublished{PostID: post.ID, AuthorID: post.UserID}); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := emitMentions(tx, post, nil); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	if len(posts) > 0 {
+		log.Printf("Published %d scheduled posts", len(posts))
+	}
+	return nil
+}
+
+// applyPostStatus validates the requested status and publish time and applies them to the post
+func applyPostStatus(post *models.Post, status string, publishAt *time.Time) error {
+	now := time.Now()
+	switch status {
+	case "", models.PostStatusPublished:
+		post.Status = models.PostStatusPublished
+		post.PublishAt = nil
+		post.PublishedAt = &now
+	case models.PostStatusDraft:
+		post.Status = models.PostStatusDraft
+		post.PublishAt = nil
+		post.PublishedAt = nil
+	case models.PostStatusScheduled:
+		if publishAt == nil || !publishAt.After(now) {
+			return fmt.Errorf("publishAt must be in the future for scheduled posts")
+		}
+		post.Status = models.PostStatusScheduled
+		post.PublishAt = publishAt
+		post.PublishedAt = nil
+	default:
+		return fmt.Errorf("invalid post status %q", status)
+	}
+	return nil
+}
+
+// maxAltTextLength caps the alt text of a single media file
+const maxAltTextLength = 1000
+
+// uploadPostMedia stores validated media files and returns their records in upload order.
+// If any upload fails, the files already stored are removed again.
+func uploadPostMedia(files []*multipart.FileHeader, infos []*utils.MediaInfo, altTexts []string) ([]models.PostMedia, error) {
+	media := make([]models.PostMedia, 0, len(files))
+	for i, file := range files {
+		info := infos[i]
+		result, err := utils.UploadMedia(file, info, "posts")
+		if err != nil {
+			go deleteStoredMedia(media)
+			return nil, fmt.Errorf("%s: %w", file.Filename, err)
+		}
+
+		item := models.PostMedia{
+			Type:     info.Type,
+			URL:      result.URL,
+			PublicID: result.PublicID,
+			ResourceType: result.ResourceType,
+			MimeType: info.MimeType,
+			Size:     info.Size,
+			Width:    result.Width,
+			Height:   result.Height,
+			Position: i,
+		}
+		if item.Width == 0 && item.Height == 0 {
+			item.Width, item.Height = info.Width, info.Height
+		}
+		if result.Flagged {
+			item.ModerationStatus = models.MediaModerationQuarantined
+			item.ModerationReason = result.FlagReason
+		}
+		if i < len(altTexts) {
+			item.AltText = altTexts[i]
+		}
+		media = append(media, item)
+	}
+	return media, nil
+}
+
+// deleteStoredMedia removes uploaded files that never got referenced, e.g. after a failed insert
+func deleteStoredMedia(media []models.PostMedia) {
+	discardStoredAssets(postMediaAssets(media))
+}
+
+// orderedMedia sorts preloaded post media in display order
+func orderedMedia(db *gorm.DB) *gorm.DB {
+	return db.Order("post_media.position ASC")
+}
+
+// postPointers returns pointers to posts and the originals they share, for
+// filling in fields that are loaded separately
+func postPointers(posts []models.Post) []*models.Post {
+	pointers := make([]*models.Post, 0, len(posts))
+	for i := range posts {
+		pointers = append(pointers, &posts[i])
+		if posts[i].OriginalPost != nil {
+			pointers = append(pointers, posts[i].OriginalPost)
+		}
+	}
+	return pointers
+}
+
+// parseUUIDs parses a list of string IDs
+func parseUUIDs(values []string) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, 0, len(values))
+	for _, value := range values {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// validatePostVisibility checks a visibility setting and its custom audience
+func validatePostVisibility(visibility string, audienceIDs []uuid.UUID) error {
+	if visibility == "" {
+		return nil
+	}
+	if !models.IsValidPostVisibility(visibility) {
+		return fmt.Errorf("invalid post visibility %q", visibility)
+	}
+	if visibility == models.PostVisibilityCustom && len(audienceIDs) == 0 {
+		return fmt.Errorf("audienceIds are required for custom visibility")
+	}
+	return nil
+}
+
+// notifyFollowersOfPost lets the author's followers know a post has been published
+func notifyFollowersOfPost(tx *gorm.DB, post *models.Post) error {
+	var author models.User
+	if err := tx.First(&author, "id = ?", post.UserID).Error; err != nil {
+		return err
+	}
+
+	// Only notify followers who are part of the post's audience
+	query := tx.Model(&models.Follow{}).Where("following_id = ?", post.UserID)
+	switch post.Visibility {
+	case models.PostVisibilityOnlyMe:
+		return nil
+	case models.PostVisibilityMentees:
+		query = query.Where("follower_id IN (?)", tx.Model(&models.Mentorship{}).
+			Select("mentee_id").Where("mentor_id = ?", post.UserID))
+	case models.PostVisibilityCustom:
+		query = query.Where("follower_id IN (?)", tx.Model(&models.PostAudience{}).
+			Select("user_id").Where("post_id = ?", post.ID))
+	}
+
+	var followerIDs []uuid.UUID
+	if err := query.Pluck("follower_id", &followerIDs).Error; err != nil {
+		return err
+	}
+	if len(followerIDs) == 0 {
+		return nil
+	}
+
+	notifications := make([]models.Notification, len(followerIDs))
+	for i, followerID := range followerIDs {
+		notifications[i] = models.Notification{
+			UserID:  followerID,
+			ActorID: post.UserID,
+			PostID:  &post.ID,
+			Type:    models.NotificationTypePost,
+			Message: fmt.Sprintf("%s published a new post", author.Name),
+		}
+	}
+	return notify(tx, notifications...)
+}
+
 // GetPost gets a post by ID
 func (pc *PostController) GetPost(c *gin.Context) {
 	id := c.Param("id")
@@ -65,12 +598,29 @@ func (pc *PostController) GetPost(c *gin.Context) {
 		return
 	}
 
+	viewer := viewerID(c)
 	var post models.Post
-	if err := config.GetDB().Preload("User").Preload("Comments").Preload("Tags").Preload("SavedBy").Preload("Likes").First(&post, id).Error; err != nil {
+	if err := config.GetDB().Preload("User").
+		Preload("Comments", notBlocked(viewer, "comments.user_id")).
+		Preload("Tags").
+		Preload("SavedBy", notBlocked(viewer, "users.id")).
+		Preload("Likes", notBlocked(viewer, "likes.user_id")).
+		Preload("Media", visibleMedia(viewer)).First(&post, "id = ?", id).Error; err != nil {
 		c.JSON(404, gin.H{"error": "Post not found"})
 		return
 	}
 
+	// Only the post's audience may see it
+	if !canViewPost(config.GetDB(), &post, viewer) {
+		c.JSON(404, gin.H{"error": "Post not found"})
+		return
+	}
+
+	// Let the author see who a custom audience post is shared with
+	if viewer != nil && *viewer == post.UserID && post.Visibility == models.PostVisibilityCustom {
+		config.GetDB().Model(&models.PostAudience{}).Where("post_id = ?", post.ID).Pluck("user_id", &post.AudienceIDs)
+	}
+
 	// Get likes and comments count
 	likesCount, _ := post.GetLikesCount(config.GetDB())
 	commentsCount, _ := post.GetCommentsCount(config.GetDB())
@@ -79,28 +629,42 @@ func (pc *PostController) GetPost(c *gin.Context) {
 	post.Analytics.Likes = int(likesCount)
 	post.Analytics.CommentCount = int(commentsCount)
 
+	if err := linkPostMentions(config.GetDB(), &post); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch post"})
+		return
+	}
+
 	c.JSON(200, post)
 }
 
 // ListPosts lists all posts with optional filters and search
 func (pc *PostController) ListPosts(c *gin.Context) {
+	viewer := viewerID(c)
 	var posts []models.Post
 	query := config.GetDB().Preload("User").
 		Preload("Tags").
-		Preload("Comments", "parent_id IS NULL").
-		Preload("OriginalPost").
-		Preload("OriginalPost.User")
+		Preload("Media", visibleMedia(viewer)).
+		Preload("Comments", func(db *gorm.DB) *gorm.DB {
+			return db.Where("parent_id IS NULL").Scopes(notBlocked(viewer, "comments.user_id"))
+		}).
+		Preload("OriginalPost", func(db *gorm.DB) *gorm.DB {
+			return db.Scopes(visiblePosts(viewer))
+		}).
+		Preload("OriginalPost.User").
+		Preload("OriginalPost.Media", visibleMedia(viewer))
 
 	// Add tag filter
 	if tagName := c.Query("tag"); tagName != "" {
 		query = query.Joins("JOIN post_tags ON post_tags.post_id = posts.id").
 			Joins("JOIN tags ON tags.id = post_tags.tag_id").
-			Where("tags.name = ?", tagName)
+			Where("lower(tags.name) = ?", utils.NormalizeTag(tagName))
 	}
 
-	// Add user filter
+	// Add user filter; without one this is the viewer's feed, which leaves out muted users
 	if userID := c.Query("user"); userID != "" {
 		query = query.Where("user_id = ?", userID)
+	} else {
+		query = query.Scopes(notMuted(viewer, "posts.user_id"))
 	}
 
 	// Add search filter
@@ -119,15 +683,14 @@ func (pc *PostController) ListPosts(c *gin.Context) {
 		query = query.Where("created_at <= ?", endDate)
 	}
 
-	// Only show public posts for non-owners
-	currentUserID, exists := c.Get("userID")
-	if !exists {
-		query = query.Where("is_private = ?", false)
-	} else {
-		query = query.Where("is_private = ? OR user_id = ?", false, currentUserID)
-	}
+	// Only show posts whose audience includes the viewer
+	query = query.Scopes(visiblePosts(viewer))
 
-	if err := query.Order("created_at DESC").Find(&posts).Error; err != nil {
+	if err := query.Order("posts.published_at DESC NULLS LAST, posts.created_at DESC").Find(&posts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch posts"})
+		return
+	}
+	if err := linkPostMentions(config.GetDB(), postPointers(posts)...); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch posts"})
 		return
 	}
@@ -135,7 +698,17 @@ func (pc *PostController) ListPosts(c *gin.Context) {
 	c.JSON(http.StatusOK, posts)
 }
 
-// SharePost shares an existing post
+// liveReshareConflict skips inserting a plain reshare the user already has, relying
+// on the idx_posts_unique_reshare partial index
+var liveReshareConflict = clause.OnConflict{
+	Columns:     []clause.Column{{Name: "user_id"}, {Name: "original_post_id"}},
+	TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "original_post_id IS NOT NULL AND is_quote = false AND deleted_at IS NULL"}}},
+	DoNothing:   true,
+}
+
+// SharePost shares an existing post. Without content it is a plain reshare, of which
+// a user can have at most one per post; with content it is a quote-share carrying
+// the sharer's own commentary. Shares of shares always point at the root original.
 func (pc *PostController) SharePost(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -143,26 +716,93 @@ func (pc *PostController) SharePost(c *gin.Context) {
 		return
 	}
 
-	originalPostID := c.Param("id")
-	var originalPost models.Post
-	if err := config.GetDB().First(&originalPost, "id = ?", originalPostID).Error; err != nil {
+	var shareData struct {
+		Content    string `json:"content"`
+		Visibility string `json:"visibility"`
+	}
+	if err := c.ShouldBindJSON(&shareData); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	originalPost, err := findShareableRoot(c.Param("id"), viewerID(c))
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Original post not found"})
 		return
 	}
 
+	// Only public posts can be shared, otherwise the share would leak them to a wider audience
+	if originalPost.Visibility != models.PostVisibilityPublic || originalPost.Status != models.PostStatusPublished {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only public posts can be shared"})
+		return
+	}
+	var originalAuthor models.User
+	if err := config.GetDB().First(&originalAuthor, "id = ?", originalPost.UserID).Error; err != nil || originalAuthor.IsPrivate {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Posts of private accounts cannot be shared"})
+		return
+	}
+
+	isQuote := strings.TrimSpace(shareData.Content) != ""
+
+	// A user has a single plain reshare per post
+	if !isQuote {
+		var existingShare models.Post
+		if err := config.GetDB().Where("user_id = ? AND original_post_id = ? AND is_quote = ?", userID, originalPost.ID, false).
+			First(&existingShare).Error; err == nil {
+			c.JSON(http.StatusOK, existingShare)
+			return
+		}
+	}
+
 	// Create shared post
 	sharedPost := models.Post{
 		UserID:         userID.(uuid.UUID),
 		OriginalPostID: &originalPost.ID,
-		IsPrivate:      false,
+		IsQuote:        isQuote,
+		Visibility:     models.PostVisibilityPublic,
+	}
+	if isQuote {
+		sharedPost.Content = shareData.Content
+		if shareData.Visibility != "" {
+			if shareData.Visibility == models.PostVisibilityCustom {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Quote-shares cannot use a custom audience"})
+				return
+			}
+			if err := validatePostVisibility(shareData.Visibility, nil); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			sharedPost.Visibility = shareData.Visibility
+		}
+	}
+	if err := applyPostStatus(&sharedPost, models.PostStatusPublished, nil); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
 	tx := config.GetDB().Begin()
-	if err := tx.Create(&sharedPost).Error; err != nil {
+	create := tx
+	if !isQuote {
+		create = tx.Clauses(liveReshareConflict)
+	}
+	result := create.Create(&sharedPost)
+	if result.Error != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share post"})
 		return
 	}
+	if result.RowsAffected == 0 {
+		// A concurrent request reshared the post first
+		tx.Rollback()
+		var existingShare models.Post
+		if err := config.GetDB().Where("user_id = ? AND original_post_id = ? AND is_quote = ?", userID, originalPost.ID, false).
+			First(&existingShare).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share post"})
+			return
+		}
+		c.JSON(http.StatusOK, existingShare)
+		return
+	}
 
 	// Increment share count
 	if err := tx.Model(&originalPost).
@@ -171,12 +811,143 @@ func (pc *PostController) SharePost(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update share count"})
 		return
 	}
+	if err := adjustPostCount(tx, sharedPost.UserID, 1); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update post count"})
+		return
+	}
+
+	// Let the original author know about the share
+	if err := events.Emit(tx, events.PostShared{
+		PostID:         sharedPost.ID,
+		OriginalPostID: originalPost.ID,
+		UserID:         sharedPost.UserID,
+		IsQuote:        isQuote,
+	}); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create notification"})
+		return
+	}
+
+	if isQuote {
+		if err := syncMentions(tx, sharedPost.UserID, sharedPost.ID, nil, sharedPost.Content); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save mentions"})
+			return
+		}
+		if err := syncHashtags(tx, &sharedPost); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save hashtags"})
+			return
+		}
+		if err := emitMentions(tx, &sharedPost, nil); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to notify mentioned users"})
+			return
+		}
+	}
 
 	tx.Commit()
+	linkPostMentions(config.GetDB(), &sharedPost)
 	c.JSON(http.StatusCreated, sharedPost)
 }
 
-// SavePost allows a user to save/bookmark a post
+// UnsharePost removes the current user's plain reshare of a post. The id may be the
+// original, a share of it or the reshare itself. The original need not be visible
+// anymore, so a reshare can still be removed after its author blocks the user or
+// deletes it.
+func (pc *PostController) UnsharePost(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	postID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+		return
+	}
+
+	// Shares always point at the root, deleted or not
+	rootID := postID
+	var post models.Post
+	if err := config.GetDB().Unscoped().Select("id", "original_post_id").First(&post, "id = ?", postID).Error; err == nil &&
+		post.OriginalPostID != nil {
+		rootID = *post.OriginalPostID
+	}
+
+	var sharedPost models.Post
+	if err := config.GetDB().Where("user_id = ? AND original_post_id = ? AND is_quote = ?", userID, rootID, false).
+		First(&sharedPost).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not shared"})
+		return
+	}
+
+	tx := config.GetDB().Begin()
+	result := tx.Delete(&sharedPost)
+	if result.Error != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unshare post"})
+		return
+	}
+
+	// A concurrent unshare may have removed it first
+	if result.RowsAffected == 1 {
+		if err := decrementShareCount(tx, rootID); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update share count"})
+			return
+		}
+		if err := adjustPostCount(tx, sharedPost.UserID, -1); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update post count"})
+			return
+		}
+	}
+
+	tx.Commit()
+	c.JSON(http.StatusOK, gin.H{"message": "Post unshared successfully"})
+}
+
+// findShareableRoot loads a post the viewer can see and follows a share to its root original
+func findShareableRoot(postID string, viewer *uuid.UUID) (models.Post, error) {
+	var post models.Post
+	if err := config.GetDB().First(&post, "id = ?", postID).Error; err != nil {
+		return post, err
+	}
+	if !canViewPost(config.GetDB(), &post, viewer) {
+		return post, gorm.ErrRecordNotFound
+	}
+
+	// Shares always point at the root, so a single hop is enough
+	if post.OriginalPostID != nil {
+		var root models.Post
+		if err := config.GetDB().First(&root, "id = ?", *post.OriginalPostID).Error; err != nil {
+			return root, err
+		}
+		if !canViewPost(config.GetDB(), &root, viewer) {
+			return root, gorm.ErrRecordNotFound
+		}
+		return root, nil
+	}
+	return post, nil
+}
+
+// decrementShareCount lowers the share counter of an original post without going below zero
+func decrementShareCount(tx *gorm.DB, postID uuid.UUID) error {
+	return tx.Model(&models.Post{}).Where("id = ?", postID).
+		UpdateColumn("analytics__shares", gorm.Expr("GREATEST(analytics__shares - 1, 0)")).Error
+}
+
+// adjustPostCount keeps the author's post counter in step with published posts
+func adjustPostCount(tx *gorm.DB, userID uuid.UUID, delta int) error {
+	return tx.Model(&models.User{}).Where("id = ?", userID).
+		UpdateColumn("post_count", gorm.Expr("GREATEST(post_count + ?, 0)", delta)).Error
+}
+
+// SavePost allows a user to save/bookmark a post. Saving an already saved post is a
+// no-op, except that it moves the post into the given collection.
 func (pc *PostController) SavePost(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -184,31 +955,105 @@ func (pc *PostController) SavePost(c *gin.Context) {
 		return
 	}
 
+	var saveData struct {
+		CollectionID *uuid.UUID `json:"collectionId"`
+	}
+	if err := c.ShouldBindJSON(&saveData); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	postID := c.Param("id")
 	var post models.Post
 	if err := config.GetDB().First(&post, "id = ?", postID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
 		return
 	}
+	if !canViewPost(config.GetDB(), &post, viewerID(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	if saveData.CollectionID != nil {
+		var collection models.BookmarkCollection
+		if err := config.GetDB().First(&collection, "id = ? AND user_id = ?", *saveData.CollectionID, userID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+			return
+		}
+	}
+
+	savedPost := models.SavedPost{
+		UserID:       userID.(uuid.UUID),
+		PostID:       post.ID,
+		CollectionID: saveData.CollectionID,
+	}
 
 	tx := config.GetDB().Begin()
-	// Add user to SavedBy
-	if err := tx.Model(&post).Association("SavedBy").Append(&models.User{ID: userID.(uuid.UUID)}); err != nil {
+	// Only the first save creates the row and counts towards the saved count
+	result := tx.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(&savedPost)
+	if result.Error != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save post"})
 		return
 	}
 
-	// Increment saved count
-	if err := tx.Model(&post).
-		UpdateColumn("analytics__saved_count", gorm.Expr("analytics__saved_count + ?", 1)).Error; err != nil {
+	if result.RowsAffected > 0 {
+		// Increment saved count
+		if err := tx.Model(&post).
+			UpdateColumn("analytics__saved_count", gorm.Expr("analytics__saved_count + ?", 1)).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update saved count"})
+			return
+		}
+	} else if saveData.CollectionID != nil {
+		// Already saved, file it under the requested collection
+		if err := tx.Model(&models.SavedPost{}).
+			Where("user_id = ? AND post_id = ?", userID, post.ID).
+			Update("collection_id", saveData.CollectionID).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move saved post"})
+			return
+		}
+	}
+
+	tx.Commit()
+	c.JSON(http.StatusOK, gin.H{"message": "Post saved successfully", "saved": true, "collectionId": saveData.CollectionID})
+}
+
+// UnsavePost removes a post from the user's bookmarks
+func (pc *PostController) UnsavePost(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	postUUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+		return
+	}
+
+	tx := config.GetDB().Begin()
+	result := tx.Where("user_id = ? AND post_id = ?", userID, postUUID).Delete(&models.SavedPost{})
+	if result.Error != nil {
 		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update saved count"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unsave post"})
 		return
 	}
 
+	// Unsaving a post that was never saved leaves the counter alone
+	if result.RowsAffected > 0 {
+		if err := tx.Model(&models.Post{}).Where("id = ?", postUUID).
+			UpdateColumn("analytics__saved_count", gorm.Expr("GREATEST(analytics__saved_count - 1, 0)")).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update saved count"})
+			return
+		}
+	}
+
 	tx.Commit()
-	c.JSON(http.StatusOK, gin.H{"message": "Post saved successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Post unsaved successfully", "saved": false})
 }
 
 // GetPostAnalytics gets analytics for a post
@@ -289,6 +1134,14 @@ func (pc *PostController) AddTagsToPost(c *gin.Context) {
 		return
 	}
 
+	// Explicitly added tags stay when the hashtag they came from is edited out
+	if err := config.GetDB().Model(&models.PostTag{}).
+		Where("post_id = ? AND tag_id IN ?", post.ID, tagIDs).
+		Update("source", models.PostTagSourceManual).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add tags"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Tags added successfully"})
 }
 
@@ -328,6 +1181,36 @@ func (pc *PostController) DeletePost(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete post comments"})
 		return
 	}
+	if err := tx.Model(&post).UpdateColumn("analytics__comment_count", 0).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment count"})
+		return
+	}
+
+	// Delete associated media records
+	var media []models.PostMedia
+	if err := tx.Where("post_id = ?", postID).Find(&media).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch post media"})
+		return
+	}
+	if err := tx.Where("post_id = ?", postID).Delete(&models.PostMedia{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete post media"})
+		return
+	}
+	if err := enqueueMediaDeletion(tx, postMediaAssets(media)); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue media deletion"})
+		return
+	}
+
+	// Delete mentions in the post and its comments
+	if err := tx.Where("post_id = ?", postID).Delete(&models.Mention{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete post mentions"})
+		return
+	}
 
 	// Delete associated tags
 	if err := tx.Exec("DELETE FROM post_tags WHERE post_id = ?", postID).Error; err != nil {
@@ -343,22 +1226,40 @@ func (pc *PostController) DeletePost(c *gin.Context) {
 		return
 	}
 
+	// Delete notifications about the post and its comments
+	if err := tx.Unscoped().Where("post_id = ?", postID).Delete(&models.Notification{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete post notifications"})
+		return
+	}
+
 	// Delete the post
 	if err := tx.Delete(&post).Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete post"})
 		return
 	}
+	if post.Status == models.PostStatusPublished {
+		if err := adjustPostCount(tx, post.UserID, -1); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update post count"})
+			return
+		}
+	}
+
+	// Removing a share or quote-share lowers the original's share count
+	if post.OriginalPostID != nil {
+		if err := decrementShareCount(tx, *post.OriginalPostID); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update share count"})
+			return
+		}
+	}
 
 	tx.Commit()
 
-	// Delete images from Cloudinary in a separate goroutine
-	go func() {
-		if err := utils.DeleteImagesFromPost(post.MediaURLs); err != nil {
-			// Log the error but don't fail the deletion
-			log.Printf("Failed to delete images from Cloudinary: %v", err)
-		}
-	}()
+	// Delete the files from media storage in the background; failures are retried by the job
+	go processMediaDeletionsNow()
 
 	c.JSON(http.StatusOK, gin.H{"message": "Post deleted successfully"})
 }
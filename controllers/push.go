@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"mentorship-backend/config"
+	"mentorship-backend/models"
+	"mentorship-backend/utils"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// pushTimeout bounds how long one push may wait on the provider
+	pushTimeout = 10 * time.Second
+	// pushMaxAge is how late a push may still arrive. Older ones are dropped
+	// rather than retried, the notification is still in the app.
+	pushMaxAge = time.Hour
+	// pushClaimLease is how long claimed deliveries are left to their sender
+	// before another instance may pick them up again
+	pushClaimLease = time.Minute
+)
+
+// pushTitles are the titles pushes of each type are shown with
+var pushTitles = map[string]string{
+	models.NotificationTypeFollow:             "New follower",
+	models.NotificationTypeComment:            "New comment",
+	models.NotificationTypeMention:            "You were mentioned",
+	models.NotificationTypeFollowRequest:      "New follow request",
+	models.NotificationTypeFollowApproved:     "Follow request approved",
+	models.NotificationTypeMentorshipRequest:  "New mentorship offer",
+	models.NotificationTypeMentorshipAccepted: "Mentorship accepted",
+}
+
+// SendPushes pushes queued notifications to their recipients' devices. Deliveries
+// are claimed in a short transaction and sent outside of it, so a slow provider
+// holds no locks. Failures are retried with backoff until MaxPushDeliveryAttempts
+// is reached. It is run periodically by the job runner.
+func SendPushes() error {
+	deliveries, err := claimPushDeliveries()
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for i := range deliveries {
+		if err := sendPush(&deliveries[i]); err != nil {
+			failed++
+			log.Printf("Failed to push notification %s: %v", deliveries[i].NotificationID, err)
+		}
+	}
+
+	if failed > 0 {
+		log.Printf("Failed to send %d of %d pushes", failed, len(deliveries))
+	}
+	return nil
+}
+
+// claimPushDeliveries picks the deliveries that are due and leases them to this
+// instance
+func claimPushDeliveries() ([]models.PushDelivery, error) {
+	tx := config.GetDB().Begin()
+
+	var deliveries []models.PushDelivery
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND next_attempt_at <= ?", models.PushDeliveryPending, time.Now()).
+		Order("next_attempt_at ASC").
+		Limit(100).
+		Find(&deliveries).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		tx.Rollback()
+		return nil, nil
+	}
+
+	ids := make([]uuid.UUID, len(deliveries))
+	for i := range deliveries {
+		ids[i] = deliveries[i].ID
+	}
+	if err := tx.Model(&models.PushDelivery{}).Where("id IN ?", ids).
+		Update("next_attempt_at", time.Now().Add(pushClaimLease)).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return deliveries, tx.Commit().Error
+}
+
+// sendPush pushes one notification to its recipient's devices, unless they have
+// read it already, and settles the delivery
+func sendPush(delivery *models.PushDelivery) error {
+	db := config.GetDB()
+
+	var notification models.Notification
+	err := db.First(&notification, "id = ?", delivery.NotificationID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return finishPushDelivery(delivery, nil, nil)
+	}
+	if err != nil {
+		return finishPushDelivery(delivery, nil, err)
+	}
+	if notification.IsRead || time.Since(notification.CreatedAt) > pushMaxAge {
+		return finishPushDelivery(delivery, nil, nil)
+	}
+
+	// The actor may have been blocked or muted since
+	var visible int64
+	if err := visibleNotifications(db, notification.UserID).
+		Where("notifications.id = ?", notification.ID).Count(&visible).Error; err != nil {
+		return finishPushDelivery(delivery, nil, err)
+	}
+
+	var tokens []string
+	if visible > 0 {
+		if err := db.Model(&models.DeviceToken{}).Where("user_id = ?", notification.UserID).
+			Pluck("token", &tokens).Error; err != nil {
+			return finishPushDelivery(delivery, nil, err)
+		}
+	}
+	if len(tokens) == 0 {
+		return finishPushDelivery(delivery, nil, nil)
+	}
+
+	data := map[string]string{
+		"notificationId": notification.ID.String(),
+		"type":           notification.Type,
+	}
+	if notification.PostID != nil {
+		data["postId"] = notification.PostID.String()
+	}
+	if notification.CommentID != nil {
+		data["commentId"] = notification.CommentID.String()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pushTimeout)
+	defer cancel()
+	invalidTokens, err := utils.GetPushSender().Send(ctx, tokens, utils.PushMessage{
+		Title:       pushTitles[notification.Type],
+		Body:        notification.Message,
+		Data:        data,
+		CollapseKey: notification.ID.String(),
+	})
+	return finishPushDelivery(delivery, invalidTokens, err)
+}
+
+// finishPushDelivery forgets the devices the provider no longer knows, and removes
+// the delivery or schedules its retry after sendErr. It returns sendErr.
+func finishPushDelivery(delivery *models.PushDelivery, invalidTokens []string, sendErr error) error {
+	tx := config.GetDB().Begin()
+
+	if len(invalidTokens) > 0 {
+		if err := tx.Where("token IN ?", invalidTokens).Delete(&models.DeviceToken{}).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if sendErr == nil {
+		if err := tx.Delete(delivery).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit().Error
+	}
+
+	delivery.Attempts++
+	delivery.LastError = sendErr.Error()
+	delivery.NextAttemptAt = time.Now().Add(pushBackoff(delivery.Attempts))
+	if delivery.Attempts >= models.MaxPushDeliveryAttempts {
+		delivery.Status = models.PushDeliveryFailed
+	}
+	if err := tx.Save(delivery).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// pushBackoff doubles the delay after every failed push, starting at 10 seconds
+func pushBackoff(attempts int) time.Duration {
+	return 10 * time.Second << uint(attempts-1)
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"mentorship-backend/config"
+	"mentorship-backend/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxMutualSample is how many mutual followers are named on a profile
+const maxMutualSample = 3
+
+// relationship describes how the viewer is connected to another user
+type relationship struct {
+	IsFollowing         bool    // The viewer follows the user
+	FollowsYou          bool    // The user follows the viewer
+	MutualFollowerCount int64   // People the viewer follows who also follow the user
+	MutualFollowers     []gin.H // A few of them, most followed first
+}
+
+// userProfile is a user along with their relationship to the viewer
+type userProfile struct {
+	models.User
+	relationship
+}
+
+// mentorProfile is a mentor along with their relationship to the viewer
+type mentorProfile struct {
+	models.MentorDetails
+	relationship
+}
+
+// getRelationship works out how the viewer is connected to a user. Mutual followers
+// are only looked up when withMutuals is set, as they reveal part of the user's
+// followers.
+func getRelationship(db *gorm.DB, viewer *uuid.UUID, userID uuid.UUID, withMutuals bool) (relationship, error) {
+	var rel relationship
+	if viewer == nil || *viewer == userID {
+		return rel, nil
+	}
+
+	rel.IsFollowing = isFollowing(db, *viewer, userID)
+	rel.FollowsYou = isFollowing(db, userID, *viewer)
+	if !withMutuals {
+		return rel, nil
+	}
+
+	query := db.Model(&models.User{}).Scopes(mutualFollowers(*viewer, userID))
+	if err := query.Count(&rel.MutualFollowerCount).Error; err != nil {
+		return rel, err
+	}
+	if rel.MutualFollowerCount == 0 {
+		return rel, nil
+	}
+
+	var users []models.User
+	if err := query.Order("follower_count DESC, id ASC").Limit(maxMutualSample).Find(&users).Error; err != nil {
+		return rel, err
+	}
+	rel.MutualFollowers = make([]gin.H, len(users))
+	for i, user := range users {
+		rel.MutualFollowers[i] = userSummary(&user)
+	}
+	return rel, nil
+}
+
+// mutualFollowers limits a users query to the people the viewer follows who also
+// follow userID
+func mutualFollowers(viewer, userID uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.
+			Where("EXISTS (SELECT 1 FROM follows WHERE follows.follower_id = ? AND follows.following_id = users.id AND follows.deleted_at IS NULL)", viewer).
+			Where("EXISTS (SELECT 1 FROM follows WHERE follows.follower_id = users.id AND follows.following_id = ? AND follows.deleted_at IS NULL)", userID).
+			Where("users.is_active = ?", true).
+			Scopes(notBlocked(&viewer, "users.id"))
+	}
+}
+
+// userSummary is the short form of a user used in lists
+func userSummary(user *models.User) gin.H {
+	return gin.H{
+		"id":        user.ID,
+		"name":      user.Name,
+		"username":  user.Username,
+		"avatarURL": user.AvatarURL,
+	}
+}
+
+// GetMutuals lists the people the current user follows who also follow the given user
+func (fc *FollowController) GetMutuals(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	viewer := userID.(uuid.UUID)
+
+	var user models.User
+	if err := config.GetDB().First(&user, "id = ?", c.Param("id")).Error; err != nil || isBlocked(config.GetDB(), &viewer, user.ID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !canViewProfile(config.GetDB(), &user, &viewer) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This account is private"})
+		return
+	}
+
+	query := config.GetDB().Model(&models.User{}).Scopes(mutualFollowers(viewer, user.ID))
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch mutual followers"})
+		return
+	}
+
+	page := getPagination(c)
+	var users []models.User
+	if err := query.Order("follower_count DESC, id ASC").Scopes(page.scope).Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch mutual followers"})
+		return
+	}
+
+	mutuals := make([]gin.H, len(users))
+	for i := range users {
+		mutuals[i] = userSummary(&users[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users": mutuals,
+		"page":  page.Page,
+		"limit": page.Limit,
+		"total": total,
+	})
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"mentorship-backend/config"
+	"mentorship-backend/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// suggestionTTL is how long a user's computed suggestions are served before
+	// being worked out again
+	suggestionTTL = 6 * time.Hour
+
+	// maxCachedSuggestions is how many suggestions are kept per user
+	maxCachedSuggestions = 100
+
+	defaultSuggestionLimit = 20
+	maxSuggestionLimit     = 50
+)
+
+// Weights of each signal in a suggestion's score
+const (
+	mutualWeight    = 3
+	sharedTagWeight = 2
+	coCommentWeight = 1
+)
+
+// suggestionsSQL scores everyone connected to the user through the people they
+// follow, the tags they share or the posts they both commented on, and keeps the
+// best candidates the user could still follow
+const suggestionsSQL = `
+WITH tag_sets AS (
+	SELECT user_tags.user_id, user_tags.tag_id FROM user_tags
+	UNION
+	SELECT mentor_details.user_id, mentor_tags.tag_id FROM mentor_tags
+	JOIN mentor_details ON mentor_details.id = mentor_tags.mentor_details_id AND mentor_details.deleted_at IS NULL
+	UNION
+	SELECT posts.user_id, post_tags.tag_id FROM post_tags
+	JOIN posts ON posts.id = post_tags.post_id AND posts.deleted_at IS NULL AND posts.status = @published
+), candidates AS (
+	SELECT theirs.following_id AS candidate_id, COUNT(DISTINCT mine.following_id) AS mutuals, 0 AS shared_tags, 0 AS co_comments
+	FROM follows mine
+	JOIN follows theirs ON theirs.follower_id = mine.following_id AND theirs.deleted_at IS NULL
+	WHERE mine.follower_id = @user AND mine.deleted_at IS NULL
+	GROUP BY theirs.following_id
+	UNION ALL
+	SELECT theirs.user_id, 0, COUNT(DISTINCT theirs.tag_id), 0
+	FROM tag_sets mine
+	JOIN tags ON tags.id = mine.tag_id AND tags.deleted_at IS NULL
+	JOIN tag_sets theirs ON theirs.tag_id = mine.tag_id
+	WHERE mine.user_id = @user
+	GROUP BY theirs.user_id
+	UNION ALL
+	SELECT theirs.user_id, 0, 0, COUNT(DISTINCT theirs.post_id)
+	FROM comments mine
+	JOIN comments theirs ON theirs.post_id = mine.post_id AND theirs.deleted_at IS NULL
+	WHERE mine.user_id = @user AND mine.deleted_at IS NULL
+	GROUP BY theirs.user_id
+)
+INSERT INTO user_suggestions (user_id, suggested_id, score, mutual_count, shared_tag_count, co_comment_count, computed_at)
+SELECT @user, candidates.candidate_id,
+	SUM(candidates.mutuals) * @mutualWeight + SUM(candidates.shared_tags) * @sharedTagWeight + SUM(candidates.co_comments) * @coCommentWeight,
+	SUM(candidates.mutuals), SUM(candidates.shared_tags), SUM(candidates.co_comments), @now
+FROM candidates
+JOIN users ON users.id = candidates.candidate_id AND users.deleted_at IS NULL AND users.is_active
+WHERE candidates.candidate_id <> @user
+	AND NOT EXISTS (SELECT 1 FROM follows WHERE follows.follower_id = @user AND follows.following_id = candidates.candidate_id AND follows.deleted_at IS NULL)
+	AND NOT EXISTS (SELECT 1 FROM blocks WHERE
+		(blocks.blocker_id = @user AND blocks.blocked_id = candidates.candidate_id)
+		OR (blocks.blocker_id = candidates.candidate_id AND blocks.blocked_id = @user))
+GROUP BY candidates.candidate_id
+ORDER BY 3 DESC, candidates.candidate_id
+LIMIT @limit
+ON CONFLICT DO NOTHING`
+
+// GetSuggestions recommends people for the current user to follow, best first
+func (fc *FollowController) GetSuggestions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	viewer := userID.(uuid.UUID)
+
+	if err := refreshSuggestions(config.GetDB(), viewer); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute suggestions"})
+		return
+	}
+
+	// Cached suggestions may be a few hours old, so drop anyone the user has since
+	// followed, asked to follow, blocked or muted, or who has left
+	var suggestions []models.UserSuggestion
+	if err := config.GetDB().
+		Joins("JOIN users ON users.id = user_suggestions.suggested_id AND users.deleted_at IS NULL AND users.is_active").
+		Where("user_suggestions.user_id = ?", viewer).
+		Where("NOT EXISTS (SELECT 1 FROM follows WHERE follows.follower_id = ? AND follows.following_id = user_suggestions.suggested_id AND follows.deleted_at IS NULL)", viewer).
+		Where("NOT EXISTS (SELECT 1 FROM follow_requests WHERE follow_requests.requester_id = ? AND follow_requests.target_id = user_suggestions.suggested_id AND follow_requests.status = ?)",
+			viewer, models.FollowRequestPending).
+		Scopes(notBlocked(&viewer, "user_suggestions.suggested_id"), notMuted(&viewer, "user_suggestions.suggested_id")).
+		Preload("Suggested").
+		Order("user_suggestions.score DESC, user_suggestions.suggested_id ASC").
+		Limit(queryInt(c, "limit", defaultSuggestionLimit, maxSuggestionLimit)).
+		Find(&suggestions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch suggestions"})
+		return
+	}
+
+	users := make([]gin.H, len(suggestions))
+	for i, suggestion := range suggestions {
+		users[i] = userSummary(&suggestion.Suggested)
+		users[i]["isPrivate"] = suggestion.Suggested.IsPrivate
+		users[i]["mutualFollowerCount"] = suggestion.MutualCount
+		users[i]["sharedTagCount"] = suggestion.SharedTagCount
+		users[i]["coCommentCount"] = suggestion.CoCommentCount
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+// refreshSuggestions recomputes a user's suggestions when they are older than
+// suggestionTTL. Users left without any suggestions are recomputed on every call,
+// so that a new user's first follows show up straight away.
+func refreshSuggestions(db *gorm.DB, userID uuid.UUID) error {
+	var computedAt *time.Time
+	if err := db.Model(&models.UserSuggestion{}).
+		Where("user_id = ?", userID).
+		Select("MAX(computed_at)").
+		Scan(&computedAt).Error; err != nil {
+		return err
+	}
+	if computedAt != nil && time.Since(*computedAt) < suggestionTTL {
+		return nil
+	}
+
+	tx := db.Begin()
+	if err := tx.Where("user_id = ?", userID).Delete(&models.UserSuggestion{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Exec(suggestionsSQL, map[string]interface{}{
+		"user":            userID,
+		"published":       models.PostStatusPublished,
+		"mutualWeight":    mutualWeight,
+		"sharedTagWeight": sharedTagWeight,
+		"coCommentWeight": coCommentWeight,
+		"now":             time.Now(),
+		"limit":           maxCachedSuggestions,
+	}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
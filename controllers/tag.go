@@ -1,12 +1,27 @@
 package controllers
 
 import (
+	"errors"
 	"mentorship-backend/config"
 	"mentorship-backend/models"
+	"mentorship-backend/utils"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxHashtags caps the number of tags a post's content can add
+const maxHashtags = 30
+
+const (
+	defaultTrendingHours = 24
+	maxTrendingHours     = 7 * 24
+	defaultTrendingLimit = 10
+	maxTrendingLimit     = 50
 )
 
 type TagController struct{}
@@ -115,3 +130,118 @@ func (tc *TagController) AddTagsToMentor(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Tags added successfully"})
 }
+
+// trendingTag is a hashtag with how much it was used within the trending window
+type trendingTag struct {
+	ID          uuid.UUID
+	Name        string
+	PostCount   int // Public posts using the hashtag
+	AuthorCount int // Distinct authors of those posts
+}
+
+// TrendingTags lists the hashtags used by the most authors in public posts published
+// within the last hours (24 by default, at most a week)
+func (tc *TagController) TrendingTags(c *gin.Context) {
+	hours := queryInt(c, "hours", defaultTrendingHours, maxTrendingHours)
+	limit := queryInt(c, "limit", defaultTrendingLimit, maxTrendingLimit)
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+
+	var tags []trendingTag
+	if err := config.GetDB().Table("post_tags").
+		Select("tags.id, tags.name, COUNT(DISTINCT posts.id) AS post_count, COUNT(DISTINCT posts.user_id) AS author_count").
+		Joins("JOIN posts ON posts.id = post_tags.post_id AND posts.deleted_at IS NULL").
+		Joins("JOIN tags ON tags.id = post_tags.tag_id AND tags.deleted_at IS NULL").
+		Where("post_tags.source = ?", models.PostTagSourceHashtag).
+		Where("posts.status = ? AND posts.visibility = ? AND posts.published_at >= ?",
+			models.PostStatusPublished, models.PostVisibilityPublic, since).
+		Group("tags.id, tags.name").
+		Order("author_count DESC, post_count DESC, tags.name ASC").
+		Limit(limit).
+		Scan(&tags).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch trending tags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tags":  tags,
+		"hours": hours,
+	})
+}
+
+// syncHashtags attaches a tag for every #hashtag in the post's content and removes
+// the tags of hashtags that are no longer there. Tags the author added explicitly
+// are left alone.
+func syncHashtags(tx *gorm.DB, post *models.Post) error {
+	names := utils.ParseHashtags(post.Content)
+	if len(names) > maxHashtags {
+		names = names[:maxHashtags]
+	}
+
+	tagIDs := make(map[uuid.UUID]bool, len(names))
+	for _, name := range names {
+		tag, err := findOrCreateTag(tx, name)
+		if err != nil {
+			return err
+		}
+		tagIDs[tag.ID] = true
+	}
+
+	var existing []models.PostTag
+	if err := tx.Where("post_id = ? AND source = ?", post.ID, models.PostTagSourceHashtag).Find(&existing).Error; err != nil {
+		return err
+	}
+
+	var removed []uuid.UUID
+	for _, row := range existing {
+		if tagIDs[row.TagID] {
+			delete(tagIDs, row.TagID)
+		} else {
+			removed = append(removed, row.TagID)
+		}
+	}
+	if len(removed) > 0 {
+		if err := tx.Where("post_id = ? AND source = ? AND tag_id IN ?", post.ID, models.PostTagSourceHashtag, removed).
+			Delete(&models.PostTag{}).Error; err != nil {
+			return err
+		}
+	}
+
+	added := make([]models.PostTag, 0, len(tagIDs))
+	for tagID := range tagIDs {
+		added = append(added, models.PostTag{PostID: post.ID, TagID: tagID, Source: models.PostTagSourceHashtag})
+	}
+	if len(added) == 0 {
+		return nil
+	}
+	// Tags the author already added explicitly keep their source
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&added).Error
+}
+
+// findOrCreateTag returns the tag with the given normalized name, ignoring case,
+// creating it as a topic or restoring a deleted one as needed
+func findOrCreateTag(tx *gorm.DB, name string) (*models.Tag, error) {
+	var tag models.Tag
+	err := tx.Unscoped().Where("lower(name) = ?", name).Order("deleted_at DESC NULLS FIRST").First(&tag).Error
+	if err == nil {
+		if tag.DeletedAt.Valid {
+			if err := tx.Unscoped().Model(&tag).Update("deleted_at", nil).Error; err != nil {
+				return nil, err
+			}
+		}
+		return &tag, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// Another post may create the same tag concurrently
+	tag = models.Tag{Name: name, Category: models.TagCategoryTopic}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tag).Error; err != nil {
+		return nil, err
+	}
+	var created models.Tag
+	if err := tx.Where("name = ?", name).First(&created).Error; err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
@@ -1,26 +1,432 @@
 package controllers
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mentorship-backend/config"
+	"mentorship-backend/models"
 	"mentorship-backend/utils"
 	"net/http"
+	"path"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-func UploadImage(c *gin.Context) {
-	// Get file from request
-	file, err := c.FormFile("image")
+type UploadController struct{}
+
+func NewUploadController() *UploadController {
+	return &UploadController{}
+}
+
+// pendingUploadTTL is how long a client has to upload and complete a signed upload
+const pendingUploadTTL = time.Hour
+
+// signUploadRequest is the body of SignUpload
+type signUploadRequest struct {
+	Purpose      string `json:"purpose" binding:"required"`
+	ResourceType string `json:"resourceType"`
+	PostID       string `json:"postId"`
+}
+
+// SignUpload returns the parameters for uploading a file straight to media storage.
+// Post uploads are attached to one of the caller's drafts or scheduled posts.
+func (uc *UploadController) SignUpload(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req signUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.ResourceType == "" {
+		req.ResourceType = models.MediaTypeImage
+	}
+	if req.ResourceType != models.MediaTypeImage && req.ResourceType != models.MediaTypeVideo {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "resourceType must be image or video"})
+		return
+	}
+
+	upload := models.PendingUpload{
+		UserID:       userID.(uuid.UUID),
+		ResourceType: req.ResourceType,
+		Purpose:      req.Purpose,
+		ExpiresAt:    time.Now().Add(pendingUploadTTL),
+	}
+
+	var folder string
+	switch req.Purpose {
+	case models.UploadPurposePost:
+		postID, err := uuid.Parse(req.PostID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "postId is required for post uploads"})
+			return
+		}
+		var post models.Post
+		if err := config.GetDB().
+			Where("id = ? AND user_id = ? AND status IN ?", postID, upload.UserID, []string{models.PostStatusDraft, models.PostStatusScheduled}).
+			First(&post).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Draft or scheduled post not found"})
+			return
+		}
+		upload.PostID = &post.ID
+		folder = "posts"
+	case models.UploadPurposeAvatar:
+		if req.ResourceType != models.MediaTypeImage {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Avatars must be images"})
+			return
+		}
+		folder = "avatars"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "purpose must be post or avatar"})
+		return
+	}
+	upload.PublicID = folder + "/" + uuid.NewString()
+
+	signed, err := utils.GetMediaStore().SignUpload(c.Request.Context(), upload.PublicID, upload.ResourceType, upload.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign upload"})
+		return
+	}
+	upload.ExpiresAt = signed.ExpiresAt
+
+	if err := config.GetDB().Create(&upload).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"uploadId": upload.ID,
+		"upload":   signed,
+	})
+}
+
+// CompleteUpload verifies a signed upload reached storage and attaches it to
+// its post or the caller's profile
+func (uc *UploadController) CompleteUpload(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req struct {
+		AltText string `json:"altText"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.AltText) > maxAltTextLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Alt text cannot exceed %d characters", maxAltTextLength)})
+		return
+	}
+
+	var upload models.PendingUpload
+	if err := config.GetDB().Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&upload).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return
+	}
+	if upload.Status != models.PendingUploadPending {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Upload is already %s", upload.Status)})
+		return
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		c.JSON(http.StatusGone, gin.H{"error": "Upload has expired"})
+		return
+	}
+
+	asset, err := utils.GetMediaStore().Stat(c.Request.Context(), upload.PublicID, upload.ResourceType)
+	if errors.Is(err, utils.ErrAssetNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File has not been uploaded"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify upload"})
 		return
 	}
 
-	// Upload to Cloudinary
-	url, err := utils.UploadImage(file, "mentorship")
+	mediaType, err := utils.CheckMedia(asset.MimeType, asset.Bytes)
+	if err == nil && mediaType != upload.ResourceType {
+		err = fmt.Errorf("expected a %s but got %s", upload.ResourceType, asset.MimeType)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		// The file can never be claimed, so drop it right away
+		rejectPendingUpload(&upload)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	info := &utils.MediaInfo{Type: mediaType, MimeType: asset.MimeType, Size: asset.Bytes, Width: asset.Width, Height: asset.Height}
+
+	// Post media is scanned here; avatars are scanned while they are processed
+	var original *utils.StoredAsset
+	if upload.Purpose == models.UploadPurposePost {
+		scanned, err := scanDirectUpload(c.Request.Context(), &upload, asset, info)
+		if errors.Is(err, utils.ErrMediaRejected) {
+			rejectPendingUpload(&upload)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan upload"})
+			return
+		}
+		if scanned.PublicID != upload.PublicID {
+			original = &utils.StoredAsset{PublicID: upload.PublicID, ResourceType: upload.ResourceType}
+		}
+		asset = scanned
+	}
+
+	tx := config.GetDB().Begin()
+
+	// Claim the upload first so concurrent completions cannot attach it twice
+	result := tx.Model(&models.PendingUpload{}).
+		Where("id = ? AND status = ?", upload.ID, models.PendingUploadPending).
+		Update("status", models.PendingUploadClaimed)
+	if result.Error != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete upload"})
 		return
 	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload is already completed"})
+		return
+	}
+
+	switch upload.Purpose {
+	case models.UploadPurposePost:
+		media, status, err := attachUploadToPost(tx, &upload, asset, mediaType, req.AltText)
+		if err != nil {
+			tx.Rollback()
+			if original != nil {
+				// Keep the upload completable, only the scanned copy goes
+				go discardStoredAssets([]utils.StoredAsset{{PublicID: asset.PublicID, ResourceType: asset.ResourceType}})
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		if original != nil {
+			if err := enqueueMediaDeletion(tx, []utils.StoredAsset{*original}); err != nil {
+				tx.Rollback()
+				go discardStoredAssets([]utils.StoredAsset{{PublicID: asset.PublicID, ResourceType: asset.ResourceType}})
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete upload"})
+				return
+			}
+		}
+		tx.Commit()
+		c.JSON(http.StatusCreated, media)
+	case models.UploadPurposeAvatar:
+		tx.Commit()
 
-	c.JSON(http.StatusOK, gin.H{"url": url})
+		// The original is re-encoded into the avatar sizes, so it is deleted either way
+		original := []utils.StoredAsset{{PublicID: upload.PublicID, ResourceType: upload.ResourceType}}
+		defer func() { go discardStoredAssets(original) }()
+
+		src, err := utils.GetMediaStore().Open(c.Request.Context(), upload.PublicID, upload.ResourceType)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read avatar"})
+			return
+		}
+		defer src.Close()
+
+		user, status, err := replaceAvatar(c.Request.Context(), upload.UserID, src, info)
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, avatarResponse(user))
+	default:
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unknown upload purpose"})
+	}
+}
+
+// attachUploadToPost adds a completed upload to the end of its post's media.
+// It returns the HTTP status to respond with when attaching fails.
+func attachUploadToPost(tx *gorm.DB, upload *models.PendingUpload, asset *utils.UploadResult, mediaType string, altText string) (*models.PostMedia, int, error) {
+	var post models.Post
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND user_id = ? AND status IN ?", upload.PostID, upload.UserID, []string{models.PostStatusDraft, models.PostStatusScheduled}).
+		First(&post).Error; err != nil {
+		return nil, http.StatusConflict, fmt.Errorf("post is no longer a draft or scheduled post")
+	}
+
+	var count int64
+	if err := tx.Model(&models.PostMedia{}).Where("post_id = ?", post.ID).Count(&count).Error; err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to attach media")
+	}
+	if count >= maxMediaPerPost {
+		return nil, http.StatusBadRequest, fmt.Errorf("a post can have at most %d media files", maxMediaPerPost)
+	}
+
+	var position int
+	if err := tx.Model(&models.PostMedia{}).Where("post_id = ?", post.ID).
+		Select("COALESCE(MAX(position) + 1, 0)").Scan(&position).Error; err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to attach media")
+	}
+
+	media := models.PostMedia{
+		PostID:       post.ID,
+		Type:         mediaType,
+		URL:          asset.URL,
+		PublicID:     asset.PublicID,
+		ResourceType: asset.ResourceType,
+		MimeType:     asset.MimeType,
+		Size:         asset.Bytes,
+		Width:        asset.Width,
+		Height:       asset.Height,
+		AltText:      altText,
+		Position:     position,
+	}
+	if asset.Flagged {
+		media.ModerationStatus = models.MediaModerationQuarantined
+		media.ModerationReason = asset.FlagReason
+	}
+	if err := tx.Create(&media).Error; err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to attach media")
+	}
+	return &media, http.StatusCreated, nil
+}
+
+// scanDirectUpload runs the media scanner over a file uploaded straight to storage.
+// When the scanner rewrites the file, e.g. to strip metadata, the cleaned copy is
+// stored next to the original and returned in its place.
+func scanDirectUpload(ctx context.Context, upload *models.PendingUpload, asset *utils.UploadResult, info *utils.MediaInfo) (*utils.UploadResult, error) {
+	src, err := utils.GetMediaStore().Open(ctx, upload.PublicID, upload.ResourceType)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	scan, err := utils.GetMediaScanner().Scan(ctx, src, info)
+	if err != nil {
+		return nil, err
+	}
+
+	scanned := *asset
+	if scan.Modified {
+		cleaned, err := utils.GetMediaStore().Upload(ctx, scan.Body, utils.UploadOptions{
+			Folder:       path.Dir(upload.PublicID),
+			ResourceType: upload.ResourceType,
+			MimeType:     info.MimeType,
+		})
+		if err != nil {
+			return nil, err
+		}
+		scanned.URL = cleaned.URL
+		scanned.PublicID = cleaned.PublicID
+		scanned.ResourceType = cleaned.ResourceType
+	}
+	scanned.Flagged = scan.Flagged
+	scanned.FlagReason = scan.Reason
+	return &scanned, nil
+}
+
+// rejectPendingUpload expires an upload that failed validation and queues its file for deletion
+func rejectPendingUpload(upload *models.PendingUpload) {
+	tx := config.GetDB().Begin()
+	if err := tx.Model(upload).Update("status", models.PendingUploadExpired).Error; err != nil {
+		tx.Rollback()
+		log.Printf("Failed to expire upload %s: %v", upload.ID, err)
+		return
+	}
+	if err := enqueueMediaDeletion(tx, []utils.StoredAsset{{PublicID: upload.PublicID, ResourceType: upload.ResourceType}}); err != nil {
+		tx.Rollback()
+		log.Printf("Failed to queue media deletion: %v", err)
+		return
+	}
+	tx.Commit()
+	go processMediaDeletionsNow()
+}
+
+// LocalUpload receives the raw file of a presigned upload when media is stored on
+// the local filesystem. The signature in the URL stands in for authentication.
+func (uc *UploadController) LocalUpload(c *gin.Context) {
+	store, ok := utils.GetMediaStore().(*utils.LocalStore)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Direct uploads go to the configured media store"})
+		return
+	}
+
+	publicID := c.Query("public_id")
+	if err := store.VerifyUpload(publicID, c.Query("expires"), c.Query("signature")); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	var upload models.PendingUpload
+	if err := config.GetDB().Where("public_id = ? AND status = ?", publicID, models.PendingUploadPending).First(&upload).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, utils.MaxVideoSize)
+	storedID, err := store.Put(publicID, body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store file"})
+		return
+	}
+
+	// The file is named after its type, completing the upload has to find it there
+	if storedID != publicID {
+		if err := config.GetDB().Model(&upload).Update("public_id", storedID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store file"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"publicId": storedID})
+}
+
+// ExpirePendingUploads gives up on signed uploads that were never completed and
+// queues whatever the clients managed to upload for deletion.
+func ExpirePendingUploads() error {
+	tx := config.GetDB().Begin()
+
+	var uploads []models.PendingUpload
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND expires_at <= ?", models.PendingUploadPending, time.Now()).
+		Limit(100).
+		Find(&uploads).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if len(uploads) == 0 {
+		tx.Rollback()
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(uploads))
+	assets := make([]utils.StoredAsset, len(uploads))
+	for i, upload := range uploads {
+		ids[i] = upload.ID
+		assets[i] = utils.StoredAsset{PublicID: upload.PublicID, ResourceType: upload.ResourceType}
+	}
+
+	if err := tx.Model(&models.PendingUpload{}).Where("id IN ?", ids).Update("status", models.PendingUploadExpired).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := enqueueMediaDeletion(tx, assets); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
 }
@@ -5,9 +5,11 @@ import (
 	"mentorship-backend/models"
 	"mentorship-backend/utils"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -33,8 +35,21 @@ func (uc *UserController) RegisterUser(c *gin.Context) {
 	}
 	user.Password = string(hashedPassword)
 
-	// Always set role to user for new registrations
+	// Always set role to user for new registrations, and start the counters from zero
 	user.Role = models.RoleUser
+	user.FollowerCount, user.FollowingCount, user.PostCount = 0, 0, 0
+
+	// A username is picked from the name unless one is given
+	if user.Username != "" {
+		if !models.IsValidUsername(user.Username) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Username must be 3 to 30 letters, digits or underscores"})
+			return
+		}
+		if usernameTaken(user.Username, uuid.Nil) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Username is already taken"})
+			return
+		}
+	}
 
 	if err := config.GetDB().Create(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
@@ -82,7 +97,7 @@ func (uc *UserController) LoginUser(c *gin.Context) {
 	// Update last login time
 	now := time.Now()
 	user.LastLoginAt = &now
-	config.GetDB().Save(&user)
+	config.GetDB().Omit(models.UserCounterFields...).Save(&user)
 
 	// Check if user is also a mentor
 	var mentorDetails models.MentorDetails
@@ -145,8 +160,8 @@ func (uc *UserController) UpdateProfile(c *gin.Context) {
 
 	var updateData struct {
 		Name      string `json:"name"`
+		Username  string `json:"username"`
 		Bio       string `json:"bio"`
-		AvatarURL string `json:"avatarUrl"`
 		IsPrivate bool   `json:"isPrivate"`
 	}
 
@@ -165,18 +180,50 @@ func (uc *UserController) UpdateProfile(c *gin.Context) {
 	if updateData.Name != "" {
 		user.Name = updateData.Name
 	}
+	if updateData.Username != "" && updateData.Username != user.Username {
+		if !models.IsValidUsername(updateData.Username) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Username must be 3 to 30 letters, digits or underscores"})
+			return
+		}
+		if usernameTaken(updateData.Username, user.ID) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Username is already taken"})
+			return
+		}
+		user.Username = updateData.Username
+	}
 	user.Bio = updateData.Bio
-	user.AvatarURL = updateData.AvatarURL
+	wasPrivate := user.IsPrivate
 	user.IsPrivate = updateData.IsPrivate
 
-	if err := config.GetDB().Save(&user).Error; err != nil {
+	tx := config.GetDB().Begin()
+	if err := tx.Omit(models.UserCounterFields...).Save(&user).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
 		return
 	}
 
+	// Going public lets everyone who asked follow right away
+	if wasPrivate && !user.IsPrivate {
+		if err := approvePendingFollowRequests(tx, user.ID); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve follow requests"})
+			return
+		}
+	}
+
+	tx.Commit()
 	c.JSON(http.StatusOK, user)
 }
 
+// usernameTaken reports whether another user already has the username, ignoring case
+func usernameTaken(username string, exceptID uuid.UUID) bool {
+	var count int64
+	config.GetDB().Unscoped().Model(&models.User{}).
+		Where("lower(username) = lower(?) AND id <> ?", username, exceptID).
+		Count(&count)
+	return count > 0
+}
+
 // ChangePassword changes the user's password
 func (uc *UserController) ChangePassword(c *gin.Context) {
 	userID, exists := c.Get("userID")
@@ -215,7 +262,7 @@ func (uc *UserController) ChangePassword(c *gin.Context) {
 	}
 
 	user.Password = string(hashedPassword)
-	if err := config.GetDB().Save(&user).Error; err != nil {
+	if err := config.GetDB().Omit(models.UserCounterFields...).Save(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
 		return
 	}
@@ -228,26 +275,55 @@ func (uc *UserController) GetUserProfile(c *gin.Context) {
 	userID := c.Param("id")
 
 	var user models.User
-	if err := config.GetDB().First(&user, "id = ?", userID).Error; err != nil {
+	if err := config.GetDB().First(&user, "id = ?", userID).Error; err != nil || isBlocked(config.GetDB(), viewerID(c), user.ID) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	// If profile is private, only show basic info
-	if user.IsPrivate {
+	// Private profiles only show basic info to anyone but their followers
+	viewer := viewerID(c)
+	if !canViewProfile(config.GetDB(), &user, viewer) {
+		rel, err := getRelationship(config.GetDB(), viewer, user.ID, false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+			return
+		}
+		followRequested := false
+		if viewer != nil {
+			var pending int64
+			config.GetDB().Model(&models.FollowRequest{}).
+				Where("requester_id = ? AND target_id = ? AND status = ?", *viewer, user.ID, models.FollowRequestPending).
+				Count(&pending)
+			followRequested = pending > 0
+		}
 		c.JSON(http.StatusOK, gin.H{
-			"id":        user.ID,
-			"name":      user.Name,
-			"avatarURL": user.AvatarURL,
-			"isPrivate": user.IsPrivate,
+			"id":              user.ID,
+			"name":            user.Name,
+			"username":        user.Username,
+			"avatarURL":       user.AvatarURL,
+			"isPrivate":       user.IsPrivate,
+			"followerCount":   user.FollowerCount,
+			"followingCount":  user.FollowingCount,
+			"postCount":       user.PostCount,
+			"followsYou":      rel.FollowsYou,
+			"followRequested": followRequested,
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, user)
+	rel, err := getRelationship(config.GetDB(), viewer, user.ID, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, userProfile{User: user, relationship: rel})
 }
 
-// GetSavedPosts gets the user's saved posts
+// GetSavedPosts gets the user's saved posts, most recently saved first.
+// Pass collection=<id> to filter by collection, or collection=none for uncategorized posts.
+// Each post carries when and into which collection it was saved, and the number of
+// saved posts is sent in X-Total-Count.
 func (uc *UserController) GetSavedPosts(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -255,16 +331,57 @@ func (uc *UserController) GetSavedPosts(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := config.GetDB().Preload("SavedPosts").
-		Preload("SavedPosts.User").
-		Preload("SavedPosts.Tags").
-		First(&user, "id = ?", userID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	viewer := viewerID(c)
+	query := config.GetDB().Model(&models.SavedPost{}).
+		Joins("JOIN posts ON posts.id = user_saved_posts.post_id AND posts.deleted_at IS NULL").
+		Where("user_saved_posts.user_id = ?", userID).
+		Scopes(visiblePosts(viewer))
+
+	if collection := c.Query("collection"); collection != "" {
+		if collection == "none" {
+			query = query.Where("user_saved_posts.collection_id IS NULL")
+		} else {
+			collectionUUID, err := uuid.Parse(collection)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+				return
+			}
+			query = query.Where("user_saved_posts.collection_id = ?", collectionUUID)
+		}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch saved posts"})
+		return
+	}
+
+	page := getPagination(c)
+	var savedPosts []models.SavedPost
+	if err := query.Preload("Post").
+		Preload("Post.User").
+		Preload("Post.Tags").
+		Preload("Post.Media", visibleMedia(viewer)).
+		Order("user_saved_posts.created_at DESC").
+		Scopes(page.scope).
+		Find(&savedPosts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch saved posts"})
+		return
+	}
+
+	posts := make([]*models.Post, len(savedPosts))
+	for i := range savedPosts {
+		savedPosts[i].Post.SavedAt = &savedPosts[i].CreatedAt
+		savedPosts[i].Post.SavedCollectionID = savedPosts[i].CollectionID
+		posts[i] = &savedPosts[i].Post
+	}
+	if err := linkPostMentions(config.GetDB(), posts...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch saved posts"})
 		return
 	}
 
-	c.JSON(http.StatusOK, user.SavedPosts)
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, posts)
 }
 
 // DeactivateAccount deactivates the user's account
@@ -282,7 +399,7 @@ func (uc *UserController) DeactivateAccount(c *gin.Context) {
 	}
 
 	user.IsActive = false
-	if err := config.GetDB().Save(&user).Error; err != nil {
+	if err := config.GetDB().Omit(models.UserCounterFields...).Save(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate account"})
 		return
 	}
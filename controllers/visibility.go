@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"mentorship-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// viewerID returns the ID of the authenticated user, or nil for anonymous requests
+func viewerID(c *gin.Context) *uuid.UUID {
+	value, exists := c.Get("userID")
+	if !exists {
+		return nil
+	}
+	id, ok := value.(uuid.UUID)
+	if !ok {
+		return nil
+	}
+	return &id
+}
+
+// visiblePosts limits a posts query to the rows the viewer is allowed to see.
+// Authors always see their own posts; everyone else only sees published posts
+// whose visibility setting includes them. Posts of private users are only shown
+// to their followers.
+func visiblePosts(viewer *uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if viewer == nil {
+			return db.Where("posts.status = ? AND posts.visibility = ?", models.PostStatusPublished, models.PostVisibilityPublic).
+				Where("NOT EXISTS (SELECT 1 FROM users WHERE users.id = posts.user_id AND users.is_private)")
+		}
+		db = notBlocked(viewer, "posts.user_id")(db)
+		return db.Where(`(posts.user_id = @viewer OR (posts.status = @published AND (
+			NOT EXISTS (SELECT 1 FROM users WHERE users.id = posts.user_id AND users.is_private)
+			OR EXISTS (
+				SELECT 1 FROM follows WHERE follows.following_id = posts.user_id AND follows.follower_id = @viewer AND follows.deleted_at IS NULL)
+		) AND (
+			posts.visibility = @public
+			OR (posts.visibility = @followers AND EXISTS (
+				SELECT 1 FROM follows WHERE follows.following_id = posts.user_id AND follows.follower_id = @viewer AND follows.deleted_at IS NULL))
+			OR (posts.visibility = @mentees AND EXISTS (
+				SELECT 1 FROM mentorships WHERE mentorships.mentor_id = posts.user_id AND mentorships.mentee_id = @viewer AND mentorships.deleted_at IS NULL))
+			OR (posts.visibility = @custom AND EXISTS (
+				SELECT 1 FROM post_audiences WHERE post_audiences.post_id = posts.id AND post_audiences.user_id = @viewer))
+		)))`, map[string]interface{}{
+			"viewer":    *viewer,
+			"published": models.PostStatusPublished,
+			"public":    models.PostVisibilityPublic,
+			"followers": models.PostVisibilityFollowers,
+			"mentees":   models.PostVisibilityMentees,
+			"custom":    models.PostVisibilityCustom,
+		})
+	}
+}
+
+// canViewPost reports whether the viewer is allowed to see the given post
+func canViewPost(db *gorm.DB, post *models.Post, viewer *uuid.UUID) bool {
+	var count int64
+	if err := db.Model(&models.Post{}).
+		Scopes(visiblePosts(viewer)).
+		Where("posts.id = ?", post.ID).
+		Count(&count).Error; err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// isFollowing reports whether followerID follows followingID
+func isFollowing(db *gorm.DB, followerID, followingID uuid.UUID) bool {
+	var count int64
+	if err := db.Model(&models.Follow{}).
+		Where("follower_id = ? AND following_id = ?", followerID, followingID).
+		Count(&count).Error; err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// canViewProfile reports whether the viewer may see a user's full profile and
+// connections. Private users only show them to themselves and their followers,
+// and blocked users never see each other's.
+func canViewProfile(db *gorm.DB, user *models.User, viewer *uuid.UUID) bool {
+	if isBlocked(db, viewer, user.ID) {
+		return false
+	}
+	if !user.IsPrivate {
+		return true
+	}
+	if viewer == nil {
+		return false
+	}
+	return *viewer == user.ID || isFollowing(db, *viewer, user.ID)
+}
+
+// notBlocked hides rows whose user column belongs to someone the viewer blocked
+// or who blocked the viewer
+func notBlocked(viewer *uuid.UUID, column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if viewer == nil {
+			return db
+		}
+		return db.Where(`NOT EXISTS (SELECT 1 FROM blocks WHERE
+			(blocks.blocker_id = @viewer AND blocks.blocked_id = `+column+`)
+			OR (blocks.blocker_id = `+column+` AND blocks.blocked_id = @viewer))`,
+			map[string]interface{}{"viewer": *viewer})
+	}
+}
+
+// notMuted hides rows whose user column belongs to someone the viewer muted
+func notMuted(viewer *uuid.UUID, column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if viewer == nil {
+			return db
+		}
+		return db.Where("NOT EXISTS (SELECT 1 FROM mutes WHERE mutes.muter_id = ? AND mutes.muted_id = "+column+")", *viewer)
+	}
+}
+
+// isBlocked reports whether the viewer and the user have blocked each other in
+// either direction. Anonymous viewers are never blocked.
+func isBlocked(db *gorm.DB, viewer *uuid.UUID, userID uuid.UUID) bool {
+	if viewer == nil {
+		return false
+	}
+	var count int64
+	if err := db.Model(&models.Block{}).
+		Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)", *viewer, userID, userID, *viewer).
+		Count(&count).Error; err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// visibleMedia orders preloaded post media and hides quarantined files from
+// everyone but the post's author
+func visibleMedia(viewer *uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = orderedMedia(db)
+		if viewer == nil {
+			return db.Where("post_media.moderation_status = ?", models.MediaModerationApproved)
+		}
+		return db.Where("(post_media.moderation_status = ? OR EXISTS (SELECT 1 FROM posts WHERE posts.id = post_media.post_id AND posts.user_id = ?))",
+			models.MediaModerationApproved, *viewer)
+	}
+}
+
+// setPostAudience replaces the users allowed to see a post with custom visibility
+func setPostAudience(tx *gorm.DB, post *models.Post, userIDs []uuid.UUID) error {
+	if err := tx.Where("post_id = ?", post.ID).Delete(&models.PostAudience{}).Error; err != nil {
+		return err
+	}
+	if post.Visibility != models.PostVisibilityCustom || len(userIDs) == 0 {
+		return nil
+	}
+
+	// Only keep IDs that belong to existing users
+	var existingIDs []uuid.UUID
+	if err := tx.Model(&models.User{}).Where("id IN ?", userIDs).Pluck("id", &existingIDs).Error; err != nil {
+		return err
+	}
+
+	audience := make([]models.PostAudience, len(existingIDs))
+	for i, userID := range existingIDs {
+		audience[i] = models.PostAudience{PostID: post.ID, UserID: userID}
+	}
+	if len(audience) == 0 {
+		return nil
+	}
+	return tx.Create(&audience).Error
+}
@@ -0,0 +1,143 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"mentorship-backend/config"
+	"mentorship-backend/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// deliveredRetention is how long delivered events are kept around for debugging
+const deliveredRetention = 7 * 24 * time.Hour
+
+// subscription decodes an outbox payload and hands it to a subscriber
+type subscription struct {
+	decode func(payload []byte) (Event, error)
+	handle func(tx *gorm.DB, event Event) error
+}
+
+var subscriptions = make(map[string][]subscription)
+
+// Subscribe calls handle for every event of type E once the transaction that
+// emitted it has committed. Handlers run in the dispatcher's transaction, and an
+// error rolls back everything the event's handlers did so it can be retried.
+// Subscribers are registered at startup, before Dispatch runs.
+func Subscribe[E Event](handle func(tx *gorm.DB, event E) error) {
+	var zero E
+	name := zero.EventName()
+	subscriptions[name] = append(subscriptions[name], subscription{
+		decode: func(payload []byte) (Event, error) {
+			var event E
+			err := json.Unmarshal(payload, &event)
+			return event, err
+		},
+		handle: func(tx *gorm.DB, event Event) error {
+			return handle(tx, event.(E))
+		},
+	})
+}
+
+// Emit records an event in the outbox as part of tx, so it is only delivered if
+// tx commits
+func Emit(tx *gorm.DB, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&models.OutboxEvent{Name: event.EventName(), Payload: string(payload)}).Error
+}
+
+// Dispatch delivers pending outbox events to their subscribers, oldest first. It
+// is run periodically by the job runner; instances share the work.
+func Dispatch() error {
+	tx := config.GetDB().Begin()
+
+	var pending []models.OutboxEvent
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND next_attempt_at <= ?", models.OutboxEventPending, time.Now()).
+		Order("created_at ASC").
+		Limit(100).
+		Find(&pending).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	failed := 0
+	for i := range pending {
+		event := &pending[i]
+		if err := tx.SavePoint("event").Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		err := deliver(tx, event)
+		if err == nil {
+			now := time.Now()
+			event.Status = models.OutboxEventDelivered
+			event.DeliveredAt = &now
+		} else {
+			// Undo whatever the handlers managed to do before failing
+			if err := tx.RollbackTo("event").Error; err != nil {
+				tx.Rollback()
+				return err
+			}
+			failed++
+			event.Attempts++
+			event.LastError = err.Error()
+			event.NextAttemptAt = time.Now().Add(retryBackoff(event.Attempts))
+			if event.Attempts >= models.MaxOutboxEventAttempts {
+				event.Status = models.OutboxEventFailed
+				log.Printf("Giving up delivering event %s %s after %d attempts: %v", event.Name, event.ID, event.Attempts, err)
+			}
+		}
+		if err := tx.Save(event).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		log.Printf("Failed to deliver %d of %d events", failed, len(pending))
+	}
+	return nil
+}
+
+// PurgeDelivered removes delivered events once they are no longer useful for
+// debugging. It is run periodically by the job runner.
+func PurgeDelivered() error {
+	return config.GetDB().
+		Where("status = ? AND delivered_at < ?", models.OutboxEventDelivered, time.Now().Add(-deliveredRetention)).
+		Delete(&models.OutboxEvent{}).Error
+}
+
+// deliver hands an event to each of its subscribers
+func deliver(tx *gorm.DB, outboxEvent *models.OutboxEvent) error {
+	for _, subscription := range subscriptions[outboxEvent.Name] {
+		event, err := subscription.decode([]byte(outboxEvent.Payload))
+		if err != nil {
+			return fmt.Errorf("decoding %s: %v", outboxEvent.Name, err)
+		}
+		if err := subscription.handle(tx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retryBackoff doubles the delay after every failed delivery, up to an hour
+func retryBackoff(attempts int) time.Duration {
+	delay := 5 * time.Second << uint(attempts-1)
+	if delay <= 0 || delay > time.Hour {
+		delay = time.Hour
+	}
+	return delay
+}
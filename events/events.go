@@ -0,0 +1,108 @@
+package events
+
+import "github.com/google/uuid"
+
+// Event is something that happened in the app that other parts of it react to
+type Event interface {
+	// EventName identifies the event in the outbox, it must not change once used
+	EventName() string
+}
+
+// UserFollowed is emitted when a user starts following another
+type UserFollowed struct {
+	FollowerID  uuid.UUID
+	FollowingID uuid.UUID
+	ViaRequest  bool // The followed user approved a follow request
+}
+
+func (UserFollowed) EventName() string { return "user.followed" }
+
+// FollowRequested is emitted when a user asks to follow a private user
+type FollowRequested struct {
+	RequestID   uuid.UUID
+	RequesterID uuid.UUID
+	TargetID    uuid.UUID
+}
+
+func (FollowRequested) EventName() string { return "follow_request.created" }
+
+// FollowRequestApproved is emitted when a private user lets the requester follow them
+type FollowRequestApproved struct {
+	RequestID   uuid.UUID
+	RequesterID uuid.UUID
+	TargetID    uuid.UUID
+}
+
+func (FollowRequestApproved) EventName() string { return "follow_request.approved" }
+
+// MentorshipRequested is emitted when a mentor offers to take a user on as their mentee
+type MentorshipRequested struct {
+	RequestID uuid.UUID
+	MentorID  uuid.UUID
+	MenteeID  uuid.UUID
+}
+
+func (MentorshipRequested) EventName() string { return "mentorship_request.created" }
+
+// MentorshipRequestAccepted is emitted when a user accepts a mentor's offer
+type MentorshipRequestAccepted struct {
+	RequestID uuid.UUID
+	MentorID  uuid.UUID
+	MenteeID  uuid.UUID
+}
+
+func (MentorshipRequestAccepted) EventName() string { return "mentorship_request.accepted" }
+
+// PostPublished is emitted when a post goes live, whether on creation, from a
+// draft or on its scheduled time
+type PostPublished struct {
+	PostID   uuid.UUID
+	AuthorID uuid.UUID
+}
+
+func (PostPublished) EventName() string { return "post.published" }
+
+// PostLiked is emitted when a user likes a post
+type PostLiked struct {
+	PostID uuid.UUID
+	UserID uuid.UUID
+}
+
+func (PostLiked) EventName() string { return "post.liked" }
+
+// PostShared is emitted when a user reshares or quotes a post
+type PostShared struct {
+	PostID         uuid.UUID // The share itself
+	OriginalPostID uuid.UUID
+	UserID         uuid.UUID
+	IsQuote        bool
+}
+
+func (PostShared) EventName() string { return "post.shared" }
+
+// CommentCreated is emitted when a user comments on a post or replies to a comment
+type CommentCreated struct {
+	CommentID uuid.UUID
+	PostID    uuid.UUID
+	UserID    uuid.UUID
+	ParentID  *uuid.UUID // Set for replies
+}
+
+func (CommentCreated) EventName() string { return "comment.created" }
+
+// PostMentioned is emitted when a published post, or one of its comments when
+// CommentID is set, may mention users who weren't notified yet
+type PostMentioned struct {
+	PostID    uuid.UUID
+	CommentID *uuid.UUID
+}
+
+func (PostMentioned) EventName() string { return "post.mentioned" }
+
+// CommentReacted is emitted when a user first reacts to a comment
+type CommentReacted struct {
+	CommentID uuid.UUID
+	UserID    uuid.UUID
+}
+
+func (CommentReacted) EventName() string { return "comment.reacted" }
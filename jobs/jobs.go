@@ -0,0 +1,21 @@
+package jobs
+
+import (
+	"log"
+	"time"
+)
+
+// Every runs fn in the background on the given interval for the lifetime of the process.
+// Failures are logged and the job keeps running on the next tick.
+func Every(name string, interval time.Duration, fn func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := fn(); err != nil {
+				log.Printf("Job %s failed: %v", name, err)
+			}
+		}
+	}()
+}
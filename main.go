@@ -3,12 +3,17 @@ package main
 import (
 	"log"
 	"mentorship-backend/config"
+	"mentorship-backend/controllers"
+	"mentorship-backend/events"
 	"mentorship-backend/handlers"
+	"mentorship-backend/jobs"
 	"mentorship-backend/models"
+	"mentorship-backend/realtime"
 	"mentorship-backend/routes"
 	"mentorship-backend/utils"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -26,22 +31,74 @@ func main() {
 	// Initialize database
 	config.InitializeDatabase()
 
-	// Initialize Cloudinary
-	if err := utils.InitCloudinary(); err != nil {
-		log.Fatal("Error initializing Cloudinary:", err)
+	// Relay notification changes from Postgres to streaming clients
+	realtime.Listen(os.Getenv("DATABASE_URL"))
+
+	// Initialize email delivery
+	utils.InitMailer()
+
+	// Initialize push notifications
+	utils.InitPushSender()
+
+	// Initialize media storage
+	if err := utils.InitMediaStore(); err != nil {
+		log.Fatal("Error initializing media storage:", err)
 	}
 
+	// Use explicit join models where the join rows carry their own data
+	config.GetDB().SetupJoinTable(&models.User{}, "SavedPosts", &models.SavedPost{})
+	config.GetDB().SetupJoinTable(&models.Post{}, "SavedBy", &models.SavedPost{})
+	config.GetDB().SetupJoinTable(&models.Post{}, "Tags", &models.PostTag{})
+	config.GetDB().SetupJoinTable(&models.Tag{}, "Posts", &models.PostTag{})
+
 	// Auto-migrate all models
 	config.GetDB().AutoMigrate(
 		&models.User{},
 		&models.MentorDetails{},
 		&models.Post{},
 		&models.Follow{},
+		&models.FollowRequest{},
+		&models.Block{},
+		&models.Mute{},
 		&models.Comment{},
 		&models.Tag{},
 		&models.Like{},
 		&models.Notification{},
+		&models.Mentorship{},
+		&models.MentorshipRequest{},
+		&models.PostAudience{},
+		&models.BookmarkCollection{},
+		&models.SavedPost{},
+		&models.PostTag{},
+		&models.PostMedia{},
+		&models.MediaDeletion{},
+		&models.PendingUpload{},
+		&models.CommentEdit{},
+		&models.CommentReaction{},
+		&models.Mention{},
+		&models.UserSuggestion{},
+		&models.NotificationActor{},
+		&models.NotificationPreference{},
+		&models.NotificationSettings{},
+		&models.OutboxEvent{},
+		&models.DeviceToken{},
+		&models.PushDelivery{},
+		&models.StreamTicket{},
 	)
+	config.RunDataMigrations()
+
+	// Build notifications from the events emitted by the controllers
+	controllers.RegisterNotificationBuilders()
+
+	// Start background jobs
+	jobs.Every("publish-scheduled-posts", time.Minute, controllers.PublishDuePosts)
+	jobs.Every("delete-media", time.Minute, controllers.ProcessMediaDeletions)
+	jobs.Every("expire-uploads", 5*time.Minute, controllers.ExpirePendingUploads)
+	jobs.Every("send-notification-digests", time.Hour, controllers.SendNotificationDigests)
+	jobs.Every("clean-up-notifications", time.Hour, controllers.CleanUpNotifications)
+	jobs.Every("dispatch-events", time.Second, events.Dispatch)
+	jobs.Every("send-pushes", time.Second, controllers.SendPushes)
+	jobs.Every("purge-events", time.Hour, events.PurgeDelivered)
 
 	// Setup Gin router in release mode
 	gin.SetMode(gin.ReleaseMode)
@@ -54,6 +111,7 @@ func main() {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, X-Unread-Count, X-Next-Cursor")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
 			return
@@ -64,6 +122,17 @@ func main() {
 	// Setup routes
 	routes.SetupRoutes(r)
 
+	// Serve media kept on the local filesystem. Browsers must not guess another type
+	// for a file, nor run anything in it if it is opened directly.
+	if store, ok := utils.GetMediaStore().(*utils.LocalStore); ok {
+		media := r.Group(utils.LocalMediaRoute, func(c *gin.Context) {
+			c.Header("X-Content-Type-Options", "nosniff")
+			c.Header("Content-Security-Policy", "default-src 'none'; sandbox")
+			c.Next()
+		})
+		media.Static("/", store.Dir)
+	}
+
 	// Add health check route
 	r.GET("/health", handlers.HealthCheckHandler)
 	r.GET("/", handlers.HealthCheckHandler)
@@ -1,12 +1,18 @@
 package middleware
 
 import (
+	"fmt"
+	"mentorship-backend/config"
+	"mentorship-backend/models"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
 )
 
 func AuthMiddleware() gin.HandlerFunc {
@@ -18,26 +24,128 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
+		claims, err := parseToken(authHeader)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		setClaims(c, claims)
+		c.Next()
+	}
+}
+
+// OptionalAuthMiddleware identifies the caller when a valid token is sent but
+// lets anonymous requests through, so public routes can tailor their output.
+func OptionalAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+			if claims, err := parseToken(authHeader); err == nil {
+				setClaims(c, claims)
+			}
+		}
+		c.Next()
+	}
+}
+
+// parseToken validates a bearer token and returns its claims
+func parseToken(authHeader string) (jwt.MapClaims, error) {
+	tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return []byte(os.Getenv("JWT_SECRET")), nil
+	})
+
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("Invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("Invalid token claims")
+	}
+
+	return claims, nil
+}
+
+// setClaims exposes the token claims to the handlers
+func setClaims(c *gin.Context, claims jwt.MapClaims) {
+	c.Set("user_id", claims["user_id"])
+	c.Set("role", claims["role"])
+
+	if userID, err := uuid.Parse(fmt.Sprint(claims["user_id"])); err == nil {
+		c.Set("userID", userID)
+	}
+	if expiresAt, err := claims.GetExpirationTime(); err == nil && expiresAt != nil {
+		c.Set("tokenExpiresAt", expiresAt.Time)
+	}
+}
 
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+// StreamAuthMiddleware authenticates streaming routes. Clients that cannot set
+// headers, like a browser's EventSource, trade their access token for a stream
+// ticket and send that as the ticket query parameter instead, so no token ends up
+// in URLs or logs. Requests with an Authorization header are handled as usual.
+func StreamAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "" {
+			AuthMiddleware()(c)
+			return
+		}
+
+		ticket := c.Query("ticket")
+		if ticket == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header or stream ticket is required"})
 			c.Abort()
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		// Deleting the ticket as it is read makes it single use
+		var streamTicket models.StreamTicket
+		result := config.GetDB().Clauses(clause.Returning{}).
+			Where("ticket_hash = ? AND expires_at > ?", models.HashStreamTicket(ticket), time.Now()).
+			Delete(&streamTicket)
+		if result.Error != nil || result.RowsAffected == 0 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired stream ticket"})
 			c.Abort()
 			return
 		}
 
-		c.Set("user_id", claims["user_id"])
-		c.Set("role", claims["role"])
+		c.Set("user_id", streamTicket.UserID.String())
+		c.Set("userID", streamTicket.UserID)
+		if streamTicket.TokenExpiresAt != nil {
+			c.Set("tokenExpiresAt", *streamTicket.TokenExpiresAt)
+		}
 		c.Next()
 	}
 }
+
+// RequireRole only lets users with one of the given roles through. It runs after
+// AuthMiddleware and looks the role up, as tokens do not carry it.
+func RequireRole(roles ...models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("userID")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+
+		var user models.User
+		if err := config.GetDB().Select("role").First(&user, "id = ?", userID).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+
+		for _, role := range roles {
+			if user.Role == role {
+				c.Set("role", string(user.Role))
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		c.Abort()
+	}
+}
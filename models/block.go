@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Block hides two users from each other. It is one-sided: only the blocker can
+// undo it.
+type Block struct {
+	BlockerID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	BlockedID uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	Blocked   User      `gorm:"foreignKey:BlockedID"`
+	CreatedAt time.Time
+}
+
+// Mute hides a user's posts from the muter's feed and their actions from the
+// muter's notifications. The muted user is not told and sees no difference.
+type Mute struct {
+	MuterID   uuid.UUID `gorm:"type:uuid;primaryKey"`
+	MutedID   uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	Muted     User      `gorm:"foreignKey:MutedID"`
+	CreatedAt time.Time
+}
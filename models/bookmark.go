@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SavedPost is the join row between a user and a post they bookmarked
+type SavedPost struct {
+	UserID       uuid.UUID           `gorm:"type:uuid;primaryKey"`
+	PostID       uuid.UUID           `gorm:"type:uuid;primaryKey"`
+	Post         Post                `gorm:"foreignKey:PostID"`
+	CollectionID *uuid.UUID          `gorm:"type:uuid;index"` // Optional collection the post is filed under
+	Collection   *BookmarkCollection `gorm:"foreignKey:CollectionID"`
+	CreatedAt    time.Time           `gorm:"not null;default:now()"` // When the post was saved
+}
+
+func (SavedPost) TableName() string {
+	return "user_saved_posts"
+}
+
+// BookmarkCollection is a named folder a user organizes saved posts into
+type BookmarkCollection struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_bookmark_collections_user_name"`
+	Name      string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_bookmark_collections_user_name"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (b *BookmarkCollection) BeforeCreate(tx *gorm.DB) error {
+	if b.ID == uuid.Nil {
+		b.ID = uuid.New()
+	}
+	return nil
+}
@@ -9,11 +9,15 @@ import (
 
 type Comment struct {
 	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	PostID    uuid.UUID `gorm:"type:uuid;not null"`
+	PostID    uuid.UUID `gorm:"type:uuid;not null;index"`
 	UserID    uuid.UUID `gorm:"type:uuid;not null"`
-	ParentID  *uuid.UUID `gorm:"type:uuid"` // For nested comments
+	ParentID  *uuid.UUID `gorm:"type:uuid;index"` // For nested comments
+	Depth      int       `gorm:"not null;default:0"` // 0 for top-level comments, parent's depth + 1 for replies
+	ReplyCount int       `gorm:"not null;default:0"` // Number of direct replies
 	Content   string    `gorm:"type:text;not null"`
-	Likes     int       `gorm:"default:0"`
+	Likes     int       `gorm:"default:0"` // Number of reactions of any type
+	EditedAt     *time.Time
+	TombstonedAt *time.Time // Set when a comment with replies is deleted; its content is cleared but the thread stays
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt `gorm:"index"`
@@ -23,6 +27,9 @@ type Comment struct {
 	User     User      `gorm:"foreignKey:UserID"`
 	Parent   *Comment  `gorm:"foreignKey:ParentID"`
 	Replies  []Comment `gorm:"foreignKey:ParentID"`
+
+	// @handles in Content that link to the mentioned users
+	Mentions []MentionSpan `gorm:"-"`
 }
 
 func (c *Comment) BeforeCreate(tx *gorm.DB) error {
@@ -31,3 +38,51 @@ func (c *Comment) BeforeCreate(tx *gorm.DB) error {
 	}
 	return nil
 }
+
+// IsTombstone reports whether the comment was deleted while it still had replies
+func (c *Comment) IsTombstone() bool {
+	return c.TombstonedAt != nil
+}
+
+// CommentEdit keeps the previous content of a comment each time it is edited
+type CommentEdit struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CommentID uuid.UUID `gorm:"type:uuid;not null;index"`
+	Content   string    `gorm:"type:text;not null"` // Content before the edit
+	CreatedAt time.Time // When the edit was made
+}
+
+func (e *CommentEdit) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+const (
+	ReactionLike       = "like"
+	ReactionLove       = "love"
+	ReactionLaugh      = "laugh"
+	ReactionInsightful = "insightful"
+	ReactionCelebrate  = "celebrate"
+)
+
+// IsValidReaction reports whether t is a known reaction type
+func IsValidReaction(t string) bool {
+	switch t {
+	case ReactionLike, ReactionLove, ReactionLaugh, ReactionInsightful, ReactionCelebrate:
+		return true
+	}
+	return false
+}
+
+// CommentReaction is a user's reaction to a comment. Each user has at most one
+// reaction per comment; Comment.Likes counts all of them.
+type CommentReaction struct {
+	CommentID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	User      User      `gorm:"foreignKey:UserID"`
+	Type      string    `gorm:"type:varchar(20);not null;default:'like'"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
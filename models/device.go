@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	DevicePlatformIOS     = "ios"
+	DevicePlatformAndroid = "android"
+	DevicePlatformWeb     = "web"
+)
+
+// IsValidDevicePlatform reports whether p is a known device platform
+func IsValidDevicePlatform(p string) bool {
+	return p == DevicePlatformIOS || p == DevicePlatformAndroid || p == DevicePlatformWeb
+}
+
+// DeviceToken is a push token of a device the user is signed in on. A token
+// belongs to the user who registered it last.
+type DeviceToken struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	Token     string    `gorm:"type:varchar(512);not null;uniqueIndex"`
+	Platform  string    `gorm:"type:varchar(20);not null"` // See DevicePlatform*
+	CreatedAt time.Time
+	UpdatedAt time.Time // When the device last registered the token
+}
+
+func (d *DeviceToken) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
+
+const (
+	PushDeliveryPending = "pending"
+	PushDeliveryFailed  = "failed" // Gave up after MaxPushDeliveryAttempts
+)
+
+// MaxPushDeliveryAttempts is how often a push is tried before it is marked failed
+const MaxPushDeliveryAttempts = 5
+
+// PushDelivery queues a notification to be pushed to its recipient's devices. It
+// is created with the notification, so the push is only sent if that commits.
+type PushDelivery struct {
+	ID             uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	NotificationID uuid.UUID `gorm:"type:uuid;not null"`
+	Status         string    `gorm:"type:varchar(20);not null;default:'pending';index"` // See PushDelivery*
+	Attempts       int       `gorm:"not null;default:0"`
+	LastError      string    `gorm:"type:text"`
+	NextAttemptAt  time.Time `gorm:"index"` // Pushed into the future while a sender has claimed the delivery
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (d *PushDelivery) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	if d.Status == "" {
+		d.Status = PushDeliveryPending
+	}
+	if d.NextAttemptAt.IsZero() {
+		d.NextAttemptAt = time.Now()
+	}
+	return nil
+}
@@ -7,6 +7,8 @@ import (
 	"gorm.io/gorm"
 )
 
+// Follow records that one user follows another. Unfollowing soft-deletes it, and a
+// pair has at most one follow that hasn't been deleted.
 type Follow struct {
 	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
 	FollowerID  uuid.UUID `gorm:"type:uuid;not null"`  // User who is following
@@ -23,3 +25,33 @@ func (f *Follow) BeforeCreate(tx *gorm.DB) error {
 	}
 	return nil
 }
+
+const (
+	FollowRequestPending  = "pending"
+	FollowRequestApproved = "approved"
+	FollowRequestRejected = "rejected"
+)
+
+// FollowRequest asks a private user for permission to follow them. A user has at
+// most one request per target; asking again after a rejection reopens it.
+type FollowRequest struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RequesterID uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_follow_requests_pair"` // User who wants to follow
+	Requester   User       `gorm:"foreignKey:RequesterID"`
+	TargetID    uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_follow_requests_pair;index"` // Private user being asked
+	Target      User       `gorm:"foreignKey:TargetID"`
+	Status      string     `gorm:"type:varchar(20);not null;default:'pending';index"` // See FollowRequest*
+	RespondedAt *time.Time // When the request was approved or rejected
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (r *FollowRequest) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	if r.Status == "" {
+		r.Status = FollowRequestPending
+	}
+	return nil
+}
@@ -7,6 +7,8 @@ import (
 	"gorm.io/gorm"
 )
 
+// Like records that a user likes a post. Unliking soft-deletes it, and a user has
+// at most one like per post that hasn't been deleted.
 type Like struct {
 	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
 	PostID    uuid.UUID `gorm:"type:uuid;not null"`
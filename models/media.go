@@ -0,0 +1,122 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	MediaTypeImage = "image"
+	MediaTypeVideo = "video"
+)
+
+const (
+	MediaModerationApproved    = "approved"
+	MediaModerationQuarantined = "quarantined" // Hidden until a moderator reviews it
+)
+
+// PostMedia is a single image or video attached to a post
+type PostMedia struct {
+	ID               uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	PostID           uuid.UUID `gorm:"type:uuid;not null;index"`
+	Type             string    `gorm:"type:varchar(10);not null"` // 'image' or 'video'
+	URL              string    `gorm:"type:text;not null"`
+	PublicID         string    `gorm:"type:varchar(255);index"` // Identifier of the asset in media storage
+	ResourceType     string    `gorm:"type:varchar(20)"`        // Storage resource type, needed to delete the asset
+	MimeType         string    `gorm:"type:varchar(100)"`
+	Size             int64
+	Width            int
+	Height           int
+	AltText          string `gorm:"type:text"`
+	Position         int    `gorm:"not null;default:0"` // Display order within the post
+	ModerationStatus string `gorm:"type:varchar(20);not null;default:'approved';index"`
+	ModerationReason string `gorm:"type:text"` // Why the media scanner flagged the file
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	DeletedAt        gorm.DeletedAt `gorm:"index"`
+}
+
+func (m *PostMedia) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	if m.ModerationStatus == "" {
+		m.ModerationStatus = MediaModerationApproved
+	}
+	return nil
+}
+
+func (PostMedia) TableName() string {
+	return "post_media"
+}
+
+const (
+	MediaDeletionPending = "pending"
+	MediaDeletionFailed  = "failed" // Gave up after MaxMediaDeletionAttempts
+)
+
+// MaxMediaDeletionAttempts is how often a deletion is tried before it is marked failed
+const MaxMediaDeletionAttempts = 10
+
+// MediaDeletion queues a stored asset for deletion so failed attempts can be retried
+type MediaDeletion struct {
+	ID            uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	PublicID      string    `gorm:"type:varchar(255);not null;index"`
+	ResourceType  string    `gorm:"type:varchar(20)"`
+	Status        string    `gorm:"type:varchar(20);not null;default:'pending';index"`
+	Attempts      int       `gorm:"not null;default:0"`
+	LastError     string    `gorm:"type:text"`
+	NextAttemptAt time.Time `gorm:"index"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (m *MediaDeletion) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	if m.Status == "" {
+		m.Status = MediaDeletionPending
+	}
+	if m.NextAttemptAt.IsZero() {
+		m.NextAttemptAt = time.Now()
+	}
+	return nil
+}
+
+const (
+	UploadPurposePost   = "post"
+	UploadPurposeAvatar = "avatar"
+)
+
+const (
+	PendingUploadPending = "pending"
+	PendingUploadClaimed = "claimed"
+	PendingUploadExpired = "expired"
+)
+
+// PendingUpload tracks a signed direct upload until the client confirms it
+type PendingUpload struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID       uuid.UUID  `gorm:"type:uuid;not null;index"`
+	PublicID     string     `gorm:"type:varchar(255);not null;uniqueIndex"`
+	ResourceType string     `gorm:"type:varchar(20);not null"`
+	Purpose      string     `gorm:"type:varchar(20);not null"` // 'post' or 'avatar'
+	PostID       *uuid.UUID `gorm:"type:uuid;index"`           // Post the media is attached to, for post uploads
+	Status       string     `gorm:"type:varchar(20);not null;default:'pending';index"`
+	ExpiresAt    time.Time  `gorm:"not null;index"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (u *PendingUpload) BeforeCreate(tx *gorm.DB) error {
+	if u.ID == uuid.Nil {
+		u.ID = uuid.New()
+	}
+	if u.Status == "" {
+		u.Status = PendingUploadPending
+	}
+	return nil
+}
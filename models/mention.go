@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Mention records that a post, or one of its comments, mentions a user
+type Mention struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;index"` // User who was mentioned
+	ActorID    uuid.UUID  `gorm:"type:uuid;not null"`       // Author of the post or comment
+	PostID     uuid.UUID  `gorm:"type:uuid;not null;index"`
+	CommentID  *uuid.UUID `gorm:"type:uuid;index"` // Set when the mention is in a comment
+	NotifiedAt *time.Time // Mentions in drafts are only notified once the post is published
+	CreatedAt  time.Time
+}
+
+func (m *Mention) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
+
+// MentionSpan is an @handle in a post or comment that links to the mentioned user.
+// Start and End are character offsets into the content, End being exclusive.
+type MentionSpan struct {
+	Start    int
+	End      int
+	UserID   uuid.UUID
+	Username string
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Mentorship links a mentor to one of their mentees
+type Mentorship struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	MentorID  uuid.UUID `gorm:"type:uuid;not null;index"` // User ID of the mentor
+	Mentor    User      `gorm:"foreignKey:MentorID"`
+	MenteeID  uuid.UUID `gorm:"type:uuid;not null;index"` // User ID of the mentee
+	Mentee    User      `gorm:"foreignKey:MenteeID"`
+	CreatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (m *Mentorship) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
+
+const (
+	MentorshipRequestPending  = "pending"
+	MentorshipRequestAccepted = "accepted"
+	MentorshipRequestRejected = "rejected"
+)
+
+// MentorshipRequest is a mentor's offer to take a user on as their mentee, which
+// only becomes a mentorship once the mentee accepts it. A mentor has at most one
+// request per mentee; offering again after a rejection reopens it.
+type MentorshipRequest struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	MentorID    uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_mentorship_requests_pair"` // User offering to mentor
+	Mentor      User       `gorm:"foreignKey:MentorID"`
+	MenteeID    uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_mentorship_requests_pair;index"` // User being asked
+	Mentee      User       `gorm:"foreignKey:MenteeID"`
+	Status      string     `gorm:"type:varchar(20);not null;default:'pending';index"` // See MentorshipRequest*
+	RespondedAt *time.Time // When the request was accepted or rejected
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (r *MentorshipRequest) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	if r.Status == "" {
+		r.Status = MentorshipRequestPending
+	}
+	return nil
+}
@@ -15,8 +15,10 @@ type Notification struct {
 	Actor     User      `gorm:"foreignKey:ActorID"`
 	PostID    *uuid.UUID `gorm:"type:uuid"` // Optional: if notification is related to a post
 	Post      Post      `gorm:"foreignKey:PostID"`
+	CommentID *uuid.UUID `gorm:"type:uuid;index"` // Optional: if notification is related to a comment
 	Type      string    `gorm:"type:varchar(50);not null"` // 'follow', 'like', 'comment', etc.
 	Message   string    `gorm:"type:text;not null"` // Human-readable message
+	ActorCount int      `gorm:"not null;default:1"` // Users grouped into the notification, ActorID being the latest
 	IsRead    bool      `gorm:"default:false"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
@@ -27,4 +29,109 @@ const (
 	NotificationTypeFollow = "follow"
 	NotificationTypeLike   = "like"
 	NotificationTypeComment = "comment"
+	NotificationTypePost    = "post"
+	NotificationTypeShare   = "share"
+	NotificationTypeCommentReaction = "comment_reaction"
+	NotificationTypeMention         = "mention"
+	NotificationTypeFollowRequest   = "follow_request"
+	NotificationTypeFollowApproved  = "follow_approved"
+	NotificationTypeMentorshipRequest  = "mentorship_request"
+	NotificationTypeMentorshipAccepted = "mentorship_accepted"
 )
+
+// NotificationTypes lists every notification type, e.g. for validating preferences
+var NotificationTypes = []string{
+	NotificationTypeFollow,
+	NotificationTypeLike,
+	NotificationTypeComment,
+	NotificationTypePost,
+	NotificationTypeShare,
+	NotificationTypeCommentReaction,
+	NotificationTypeMention,
+	NotificationTypeFollowRequest,
+	NotificationTypeFollowApproved,
+	NotificationTypeMentorshipRequest,
+	NotificationTypeMentorshipAccepted,
+}
+
+// IsValidNotificationType reports whether t is a known notification type
+func IsValidNotificationType(t string) bool {
+	for _, notificationType := range NotificationTypes {
+		if t == notificationType {
+			return true
+		}
+	}
+	return false
+}
+
+// PushNotificationTypes are the types pushed to the recipient's devices, unless
+// they turned pushes of the type off
+var PushNotificationTypes = []string{
+	NotificationTypeFollow,
+	NotificationTypeComment,
+	NotificationTypeMention,
+	NotificationTypeFollowRequest,
+	NotificationTypeFollowApproved,
+	NotificationTypeMentorshipRequest,
+	NotificationTypeMentorshipAccepted,
+}
+
+// IsPushNotificationType reports whether notifications of type t are pushed
+func IsPushNotificationType(t string) bool {
+	for _, notificationType := range PushNotificationTypes {
+		if t == notificationType {
+			return true
+		}
+	}
+	return false
+}
+
+// NotificationActor records who a grouped notification is from, so repeated
+// actions of the same user are only counted once
+type NotificationActor struct {
+	NotificationID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	ActorID        uuid.UUID `gorm:"type:uuid;primaryKey"`
+	CreatedAt      time.Time
+}
+
+const (
+	NotificationChannelInApp = "in_app" // Shown in the app only
+	NotificationChannelEmail = "email"  // Shown in the app and included in the email digest
+	NotificationChannelOff   = "off"    // Not created at all
+)
+
+// IsValidNotificationChannel reports whether c is a known delivery channel
+func IsValidNotificationChannel(c string) bool {
+	return c == NotificationChannelInApp || c == NotificationChannelEmail || c == NotificationChannelOff
+}
+
+// NotificationPreference is how a user wants to receive one type of notification.
+// Types without a preference are delivered in the app, and pushed if they are one
+// of PushNotificationTypes.
+type NotificationPreference struct {
+	UserID       uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Type         string    `gorm:"type:varchar(50);primaryKey"`
+	Channel      string    `gorm:"type:varchar(20);not null"` // See NotificationChannel*
+	PushDisabled bool      `gorm:"not null;default:false"`    // The user opted out of pushes of this type
+}
+
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+	DigestOff    = "off"
+)
+
+// NotificationSettings holds a user's notification settings that apply to every type
+type NotificationSettings struct {
+	UserID          uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	DigestFrequency string     `gorm:"type:varchar(20);not null;default:'daily'"` // See Digest*
+	DigestSentAt    *time.Time // When the last digest was sent, nil if none was
+	UpdatedAt       time.Time
+}
+
+func (s *NotificationSettings) BeforeCreate(tx *gorm.DB) error {
+	if s.DigestFrequency == "" {
+		s.DigestFrequency = DigestDaily
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	OutboxEventPending   = "pending"
+	OutboxEventDelivered = "delivered"
+	OutboxEventFailed    = "failed" // Gave up after MaxOutboxEventAttempts
+)
+
+// MaxOutboxEventAttempts is how often an event is delivered before it is marked failed
+const MaxOutboxEventAttempts = 10
+
+// OutboxEvent is a domain event recorded in the transaction that caused it. It is
+// delivered to its subscribers once that transaction has committed, and never if
+// it rolled back.
+type OutboxEvent struct {
+	ID            uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Name          string    `gorm:"type:varchar(100);not null"`
+	Payload       string    `gorm:"type:jsonb;not null"`
+	Status        string    `gorm:"type:varchar(20);not null;default:'pending';index"` // See OutboxEvent*
+	Attempts      int       `gorm:"not null;default:0"`
+	LastError     string    `gorm:"type:text"`
+	NextAttemptAt time.Time `gorm:"index"`
+	DeliveredAt   *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (e *OutboxEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	if e.Status == "" {
+		e.Status = OutboxEventPending
+	}
+	if e.NextAttemptAt.IsZero() {
+		e.NextAttemptAt = time.Now()
+	}
+	return nil
+}
@@ -21,8 +21,10 @@ type Post struct {
 	UserID    uuid.UUID `gorm:"type:uuid;not null"`
 	User      User      `gorm:"foreignKey:UserID"`
 	Content   string    `gorm:"type:text"`
-	MediaURLs []string  `gorm:"type:text[]"`
-	IsPrivate bool      `gorm:"default:false"`
+	Visibility string   `gorm:"type:varchar(20);not null;default:'public';index"` // Who can see the post, see PostVisibility*
+	Status    string    `gorm:"type:varchar(20);not null;default:'published';index"` // 'draft', 'scheduled' or 'published'
+	PublishAt *time.Time `gorm:"index"` // When a scheduled post goes live
+	PublishedAt *time.Time
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt `gorm:"index"`
@@ -31,7 +33,8 @@ type Post struct {
 	Analytics PostAnalytics `gorm:"embedded"`
 
 	// Sharing
-	OriginalPostID *uuid.UUID `gorm:"type:uuid"` // If this is a shared post
+	OriginalPostID *uuid.UUID `gorm:"type:uuid;index"` // If this is a shared post, always the root original
+	IsQuote        bool       `gorm:"default:false"`    // Quote-shares carry the sharer's own commentary
 	OriginalPost   *Post      `gorm:"foreignKey:OriginalPostID"`
 	SharedPosts    []Post     `gorm:"foreignKey:OriginalPostID"` // Posts that shared this post
 
@@ -46,12 +49,62 @@ type Post struct {
 
 	// Likes
 	Likes []Like `gorm:"foreignKey:PostID"`
+
+	// Images and videos, in display order
+	Media []PostMedia `gorm:"foreignKey:PostID"`
+
+	// Users allowed to see a post with custom visibility
+	AudienceIDs []uuid.UUID `gorm:"-"`
+
+	// @handles in Content that link to the mentioned users
+	Mentions []MentionSpan `gorm:"-"`
+
+	// When and into which collection the current user saved the post, filled in
+	// when listing their saved posts
+	SavedAt           *time.Time `gorm:"-"`
+	SavedCollectionID *uuid.UUID `gorm:"-"`
+}
+
+// PostAudience grants a single user access to a post with custom visibility
+type PostAudience struct {
+	PostID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	CreatedAt time.Time
+}
+
+const (
+	PostStatusDraft     = "draft"
+	PostStatusScheduled = "scheduled"
+	PostStatusPublished = "published"
+)
+
+const (
+	PostVisibilityPublic    = "public"    // Everyone
+	PostVisibilityFollowers = "followers" // The author's followers
+	PostVisibilityMentees   = "mentees"   // The author's mentees
+	PostVisibilityOnlyMe    = "only_me"   // Only the author
+	PostVisibilityCustom    = "custom"    // The users listed in post_audiences
+)
+
+// IsValidPostVisibility reports whether v is a known visibility setting
+func IsValidPostVisibility(v string) bool {
+	switch v {
+	case PostVisibilityPublic, PostVisibilityFollowers, PostVisibilityMentees, PostVisibilityOnlyMe, PostVisibilityCustom:
+		return true
+	}
+	return false
 }
 
 func (p *Post) BeforeCreate(tx *gorm.DB) error {
 	if p.ID == uuid.Nil {
 		p.ID = uuid.New()
 	}
+	if p.Status == "" {
+		p.Status = PostStatusPublished
+	}
+	if p.Visibility == "" {
+		p.Visibility = PostVisibilityPublic
+	}
 	return nil
 }
 
@@ -64,10 +117,10 @@ func (p *Post) GetLikesCount(db *gorm.DB) (int64, error) {
 	return count, nil
 }
 
-// GetCommentsCount returns the number of comments for a post
+// GetCommentsCount returns the number of comments for a post, not counting tombstones
 func (p *Post) GetCommentsCount(db *gorm.DB) (int64, error) {
 	var count int64
-	if err := db.Model(&Comment{}).Where("post_id = ?", p.ID).Count(&count).Error; err != nil {
+	if err := db.Model(&Comment{}).Where("post_id = ? AND tombstoned_at IS NULL", p.ID).Count(&count).Error; err != nil {
 		return 0, err
 	}
 	return count, nil
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StreamTicket lets a client open a notification stream without putting its
+// access token in the URL. Tickets can be used once and expire quickly; only their
+// hash is stored.
+type StreamTicket struct {
+	TicketHash     string     `gorm:"type:varchar(64);primaryKey"`
+	UserID         uuid.UUID  `gorm:"type:uuid;not null"`
+	TokenExpiresAt *time.Time // When the access token the ticket was traded for expires
+	ExpiresAt      time.Time  `gorm:"not null;index"`
+	CreatedAt      time.Time
+}
+
+// HashStreamTicket returns the hash a ticket is stored under
+func HashStreamTicket(ticket string) string {
+	sum := sha256.Sum256([]byte(ticket))
+	return hex.EncodeToString(sum[:])
+}
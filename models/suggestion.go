@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserSuggestion is a cached recommendation of someone for a user to follow. A
+// user's suggestions are recomputed together once they go stale.
+type UserSuggestion struct {
+	UserID         uuid.UUID `gorm:"type:uuid;primaryKey"` // User the suggestion is for
+	SuggestedID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Suggested      User      `gorm:"foreignKey:SuggestedID"`
+	Score          int       `gorm:"not null"`
+	MutualCount    int       `gorm:"not null;default:0"` // People the user follows who follow them
+	SharedTagCount int       `gorm:"not null;default:0"` // Tags both are interested in or post about
+	CoCommentCount int       `gorm:"not null;default:0"` // Posts both have commented on
+	ComputedAt     time.Time `gorm:"not null;index"`
+}
@@ -20,3 +20,25 @@ type Tag struct {
 	Mentors []MentorDetails `gorm:"many2many:mentor_tags;"`
 	Posts   []Post          `gorm:"many2many:post_tags;"`
 }
+
+const TagCategoryTopic = "topic" // Tags created from #hashtags
+
+const (
+	PostTagSourceManual  = "manual"  // Added explicitly by the author
+	PostTagSourceHashtag = "hashtag" // Extracted from a #hashtag in the post's content
+)
+
+// PostTag is the join row between a post and one of its tags
+type PostTag struct {
+	PostID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	TagID     uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	Source    string    `gorm:"type:varchar(20);not null;default:'manual'"` // How the tag was attached, see PostTagSource*
+	CreatedAt time.Time `gorm:"not null;default:now()"`
+}
+
+func (p *PostTag) BeforeCreate(tx *gorm.DB) error {
+	if p.Source == "" {
+		p.Source = PostTagSourceManual
+	}
+	return nil
+}
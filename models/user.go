@@ -1,6 +1,8 @@
 package models
 
 import (
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,20 +12,32 @@ import (
 type Role string
 
 const (
-	RoleUser Role = "user"
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator" // Reviews quarantined media
 )
 
+// IsValidRole reports whether r is a known role
+func IsValidRole(r Role) bool {
+	return r == RoleUser || r == RoleModerator
+}
+
 type User struct {
 	ID           uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
 	FirebaseUID  string    `gorm:"type:varchar(128);unique;not null"` // Firebase UID
 	Name         string    `gorm:"not null"`
+	Username     string    `gorm:"type:varchar(30)"` // Handle used in @mentions, unique regardless of case
 	Email        string    `gorm:"uniqueIndex"` // Optional for phone auth
 	PhoneNumber  string    `gorm:"type:varchar(20);uniqueIndex"` // Optional for email auth
 	Password     string    `gorm:""` // Optional now, as Firebase handles auth
 	Role         Role      `gorm:"type:varchar(20);not null;default:'user'"`
 	Bio          string    `gorm:"type:text"`
 	AvatarURL    string    `gorm:"type:text"`
+	AvatarPublicID   string            `gorm:"type:varchar(255)"` // Media store ID of an uploaded avatar, empty for external URLs
+	AvatarThumbnails []AvatarThumbnail `gorm:"type:jsonb;serializer:json"`
 	IsPrivate    bool      `gorm:"default:false"`
+	FollowerCount  int `gorm:"not null;default:0"` // Kept in step with follows
+	FollowingCount int `gorm:"not null;default:0"`
+	PostCount      int `gorm:"not null;default:0"` // Published posts, including shares
 	IsActive     bool      `gorm:"default:true"`
 	LastLoginAt  *time.Time
 	CreatedAt    time.Time
@@ -35,7 +49,34 @@ type User struct {
 	Tags       []Tag  `gorm:"many2many:user_tags;"`
 }
 
-// BeforeCreate will set default role
+// UserCounterFields are the denormalized counters of a user. They are only changed
+// with relative updates, so saves of a loaded user must leave them out.
+var UserCounterFields = []string{"FollowerCount", "FollowingCount", "PostCount"}
+
+// AvatarThumbnail is a smaller rendition of the user's avatar
+type AvatarThumbnail struct {
+	Size     int
+	URL      string
+	PublicID string
+}
+
+const (
+	MinUsernameLength = 3
+	MaxUsernameLength = 30
+)
+
+var (
+	usernamePattern  = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+	nonUsernameChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+)
+
+// IsValidUsername reports whether name can be used as a username: 3 to 30
+// letters, digits or underscores
+func IsValidUsername(name string) bool {
+	return usernamePattern.MatchString(name)
+}
+
+// BeforeCreate will set default role and pick a username from the user's name
 func (u *User) BeforeCreate(tx *gorm.DB) error {
 	if u.ID == uuid.Nil {
 		u.ID = uuid.New()
@@ -43,5 +84,38 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	if u.Role == "" {
 		u.Role = RoleUser
 	}
+	if u.Username == "" {
+		username, err := availableUsername(tx, u.Name)
+		if err != nil {
+			return err
+		}
+		u.Username = username
+	}
 	return nil
 }
+
+// availableUsername derives a username from a display name, adding a random
+// suffix when the plain version is taken
+func availableUsername(tx *gorm.DB, name string) (string, error) {
+	base := strings.ToLower(nonUsernameChars.ReplaceAllString(name, ""))
+	if len(base) > 20 {
+		base = base[:20]
+	}
+	if len(base) < MinUsernameLength {
+		base = "user"
+	}
+
+	candidate := base
+	for attempt := 0; attempt < 5; attempt++ {
+		var count int64
+		if err := tx.Session(&gorm.Session{NewDB: true}).Unscoped().Model(&User{}).
+			Where("lower(username) = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = base + "_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:6]
+	}
+	return candidate, nil
+}
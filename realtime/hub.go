@@ -0,0 +1,90 @@
+package realtime
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+const (
+	EventCreated = "created" // A notification was added for the user, or another user was grouped into one
+	EventChanged = "changed" // Notifications were read or removed, so the unread count may differ
+	EventResync  = "resync"  // Events may have been missed, e.g. while reconnecting to Postgres
+)
+
+// subscriberBuffer is how many events a slow subscriber can fall behind by before
+// further events are dropped
+const subscriberBuffer = 16
+
+// Event tells a user's subscribers that their notifications changed
+type Event struct {
+	Type           string     `json:"type"`
+	UserID         uuid.UUID  `json:"userId"`
+	NotificationID *uuid.UUID `json:"notificationId,omitempty"` // Set for EventCreated
+}
+
+// Hub hands notification events to the subscribers of the user they concern
+type Hub struct {
+	mu          sync.RWMutex
+	subscribers map[uuid.UUID]map[chan Event]struct{}
+}
+
+var hub = &Hub{subscribers: make(map[uuid.UUID]map[chan Event]struct{})}
+
+// GetHub returns the hub of this process
+func GetHub() *Hub {
+	return hub
+}
+
+// Subscribe receives the events of a user until the returned function is called
+func (h *Hub) Subscribe(userID uuid.UUID) (<-chan Event, func()) {
+	events := make(chan Event, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[chan Event]struct{})
+	}
+	h.subscribers[userID][events] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers[userID], events)
+			if len(h.subscribers[userID]) == 0 {
+				delete(h.subscribers, userID)
+			}
+			h.mu.Unlock()
+		})
+	}
+}
+
+// Publish hands an event to the user's subscribers. Subscribers that are too far
+// behind miss it rather than holding up everyone else.
+func (h *Hub) Publish(event Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for events := range h.subscribers[event.UserID] {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// resync tells every subscriber that events may have been missed
+func (h *Hub) resync() {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for userID, subscribers := range h.subscribers {
+		for events := range subscribers {
+			select {
+			case events <- Event{Type: EventResync, UserID: userID}:
+			default:
+			}
+		}
+	}
+}
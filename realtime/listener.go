@@ -0,0 +1,71 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// NotificationChannel is the Postgres channel the notifications table trigger
+// announces changes on. Every instance listens on it, so a change made by one
+// reaches the clients connected to any of them.
+const NotificationChannel = "notification_events"
+
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+)
+
+// Listen relays events from the notification channel to the hub for the lifetime
+// of the process, reconnecting to Postgres whenever the connection is lost
+func Listen(dsn string) {
+	go func() {
+		delay := minReconnectDelay
+		for {
+			start := time.Now()
+			err := listen(context.Background(), dsn)
+			log.Printf("Notification listener stopped: %v", err)
+
+			// Back off while the database stays unreachable
+			if time.Since(start) > maxReconnectDelay {
+				delay = minReconnectDelay
+			}
+			time.Sleep(delay)
+			if delay *= 2; delay > maxReconnectDelay {
+				delay = maxReconnectDelay
+			}
+		}
+	}()
+}
+
+func listen(ctx context.Context, dsn string) error {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+NotificationChannel); err != nil {
+		return err
+	}
+
+	// Anything sent while we were not listening was lost
+	hub.resync()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var event Event
+		if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			log.Printf("Ignoring malformed notification event %q: %v", notification.Payload, err)
+			continue
+		}
+		hub.Publish(event)
+	}
+}
@@ -3,6 +3,7 @@ package routes
 import (
 	"mentorship-backend/controllers"
 	"mentorship-backend/middleware"
+	"mentorship-backend/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,9 +18,15 @@ func SetupRoutes(r *gin.Engine) {
 	authController := controllers.NewAuthController()
 	likeController := controllers.NewLikeController()
 	notificationController := controllers.NewNotificationController()
+	bookmarkController := controllers.NewBookmarkController()
+	uploadController := controllers.NewUploadController()
+	moderationController := controllers.NewModerationController()
+	blockController := controllers.NewBlockController()
+	deviceController := controllers.NewDeviceController()
 
 	// Public routes
 	public := r.Group("/api")
+	public.Use(middleware.OptionalAuthMiddleware())
 	{
 		// Auth routes
 		public.POST("/auth/firebase", authController.AuthenticateWithFirebase)
@@ -38,11 +45,17 @@ func SetupRoutes(r *gin.Engine) {
 
 		// Public tag routes
 		public.GET("/tags", tagController.ListTags)
+		public.GET("/tags/trending", tagController.TrendingTags)
 
 		// Public post routes
 		public.GET("/posts", postController.ListPosts)
 		public.GET("/posts/:id", postController.GetPost)
 		public.GET("/posts/:id/comments", commentController.GetComments)
+		public.GET("/comments/:id/replies", commentController.GetReplies)
+		public.GET("/comments/:id/history", commentController.GetCommentHistory)
+
+		// Presigned uploads to local media storage, authorized by their signature
+		public.PUT("/uploads/local", uploadController.LocalUpload)
 	}
 
 	// Protected routes
@@ -53,16 +66,39 @@ func SetupRoutes(r *gin.Engine) {
 		protected.GET("/profile", userController.GetProfile)
 		protected.PUT("/profile", userController.UpdateProfile)
 		protected.PUT("/profile/password", userController.ChangePassword)
+		protected.PUT("/profile/avatar", userController.UploadAvatar)
 		protected.GET("/profile/saved-posts", userController.GetSavedPosts)
+		protected.GET("/profile/drafts", postController.ListDrafts)
+		protected.GET("/profile/collections", bookmarkController.ListCollections)
+		protected.POST("/profile/collections", bookmarkController.CreateCollection)
+		protected.PUT("/profile/collections/:id", bookmarkController.RenameCollection)
+		protected.DELETE("/profile/collections/:id", bookmarkController.DeleteCollection)
 		protected.POST("/profile/deactivate", userController.DeactivateAccount)
 		
 		// Follow routes
 		protected.POST("/users/:id/follow", followController.FollowUser)
 		protected.DELETE("/users/:id/follow", followController.UnfollowUser)
+		protected.GET("/users/suggestions", followController.GetSuggestions)
+		protected.GET("/users/:id/mutuals", followController.GetMutuals)
+		protected.POST("/users/:id/block", blockController.BlockUser)
+		protected.DELETE("/users/:id/block", blockController.UnblockUser)
+		protected.POST("/users/:id/mute", blockController.MuteUser)
+		protected.DELETE("/users/:id/mute", blockController.UnmuteUser)
+		protected.GET("/profile/blocks", blockController.ListBlocks)
+		protected.GET("/profile/mutes", blockController.ListMutes)
+		protected.GET("/profile/follow-requests", followController.ListFollowRequests)
+		protected.POST("/profile/follow-requests/:id/approve", followController.ApproveFollowRequest)
+		protected.POST("/profile/follow-requests/:id/reject", followController.RejectFollowRequest)
+		protected.GET("/profile/mentorship-requests", mentorController.ListMentorshipRequests)
+		protected.POST("/profile/mentorship-requests/:id/accept", mentorController.AcceptMentorshipRequest)
+		protected.POST("/profile/mentorship-requests/:id/reject", mentorController.RejectMentorshipRequest)
 		
 		// Protected mentor routes
 		protected.POST("/mentor/profile", mentorController.CreateMentorProfile)
 		protected.PUT("/mentor/availability", mentorController.UpdateAvailability)
+		protected.GET("/mentor/mentees", mentorController.ListMentees)
+		protected.POST("/mentor/mentees/:id", mentorController.AddMentee)
+		protected.DELETE("/mentor/mentees/:id", mentorController.RemoveMentee)
 
 		// Protected tag routes
 		protected.POST("/tags", tagController.CreateTag)
@@ -73,11 +109,21 @@ func SetupRoutes(r *gin.Engine) {
 		protected.GET("/notifications", notificationController.GetNotifications)
 		protected.PUT("/notifications/:id/read", notificationController.MarkAsRead)
 		protected.PUT("/notifications/read-all", notificationController.MarkAllAsRead)
+		protected.DELETE("/notifications/:id", notificationController.DeleteNotification)
+		protected.POST("/notifications/stream-ticket", notificationController.CreateStreamTicket)
+		protected.POST("/notifications/delete", notificationController.DeleteNotifications)
+		protected.GET("/profile/notification-preferences", notificationController.GetNotificationPreferences)
+		protected.PUT("/profile/notification-preferences", notificationController.UpdateNotificationPreferences)
+		protected.POST("/profile/devices", deviceController.RegisterDevice)
+		protected.DELETE("/profile/devices/:token", deviceController.UnregisterDevice)
 
 		// Protected post routes
 		protected.POST("/posts", postController.CreatePost)
+		protected.PUT("/posts/:id", postController.UpdatePost)
 		protected.POST("/posts/:id/share", postController.SharePost)
+		protected.DELETE("/posts/:id/share", postController.UnsharePost)
 		protected.POST("/posts/:id/save", postController.SavePost)
+		protected.DELETE("/posts/:id/save", postController.UnsavePost)
         protected.GET("/posts/:id/analytics", postController.GetPostAnalytics)
 		protected.POST("/posts/:id/tags", postController.AddTagsToPost)
 		protected.DELETE("/posts/:id", postController.DeletePost)
@@ -85,8 +131,32 @@ func SetupRoutes(r *gin.Engine) {
 		protected.DELETE("/posts/:id/like", likeController.UnlikePost)
 		protected.GET("/posts/:id/likes", likeController.GetPostLikes)
 
+		// Protected upload routes
+		protected.POST("/uploads/sign", uploadController.SignUpload)
+		protected.POST("/uploads/:id/complete", uploadController.CompleteUpload)
+
 		// Protected comment routes
 		protected.POST("/posts/:id/comments", commentController.CreateComment)
 		protected.POST("/comments/:id/reply", commentController.ReplyToComment)
+		protected.PUT("/comments/:id", commentController.UpdateComment)
+		protected.DELETE("/comments/:id", commentController.DeleteComment)
+		protected.PUT("/comments/:id/reactions", commentController.ReactToComment)
+		protected.DELETE("/comments/:id/reactions", commentController.RemoveCommentReaction)
+	}
+
+	// Moderator routes
+	moderation := r.Group("/api/moderation")
+	moderation.Use(middleware.AuthMiddleware(), middleware.RequireRole(models.RoleModerator))
+	{
+		moderation.GET("/media", moderationController.ListQuarantinedMedia)
+		moderation.POST("/media/:id/approve", moderationController.ApproveMedia)
+		moderation.POST("/media/:id/reject", moderationController.RejectMedia)
+	}
+
+	// Streaming routes, which also accept a single-use stream ticket in the query string
+	stream := r.Group("/api")
+	stream.Use(middleware.StreamAuthMiddleware())
+	{
+		stream.GET("/notifications/stream", notificationController.StreamNotifications)
 	}
 }
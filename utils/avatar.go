@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+)
+
+const (
+	MinAvatarDimension = 128         // Smallest width or height accepted for an avatar
+	MaxAvatarDimension = 4096        // Largest width or height decoded for an avatar
+	MaxAvatarPixels    = 4096 * 3072 // Most pixels decoded for an avatar, bounding the memory it takes
+)
+
+// AvatarSizes are the square sizes an avatar is stored in, largest first.
+// The first one is the main avatar, the rest are thumbnails.
+var AvatarSizes = []int{512, 128, 48}
+
+// avatarJPEGQuality is the quality avatars are re-encoded with
+const avatarJPEGQuality = 90
+
+// AvatarImage is one size of a processed avatar, encoded as JPEG
+type AvatarImage struct {
+	Size int
+	Data []byte
+}
+
+// ProcessAvatar validates an avatar image, crops it to a centered square and
+// renders it in every AvatarSize. Re-encoding also drops any embedded metadata.
+func ProcessAvatar(r io.Reader) ([]AvatarImage, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxImageSize {
+		return nil, fmt.Errorf("avatar exceeds the %d MB limit", MaxImageSize>>20)
+	}
+
+	// Check the dimensions before decoding so huge images are never loaded into memory
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("avatar must be a JPEG, PNG or GIF image")
+	}
+	if config.Width < MinAvatarDimension || config.Height < MinAvatarDimension {
+		return nil, fmt.Errorf("avatar must be at least %dx%d pixels", MinAvatarDimension, MinAvatarDimension)
+	}
+	if config.Width > MaxAvatarDimension || config.Height > MaxAvatarDimension {
+		return nil, fmt.Errorf("avatar cannot be larger than %dx%d pixels", MaxAvatarDimension, MaxAvatarDimension)
+	}
+	if config.Width*config.Height > MaxAvatarPixels {
+		return nil, fmt.Errorf("avatar cannot have more than %d megapixels", MaxAvatarPixels/1000000)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("avatar could not be decoded")
+	}
+
+	square := cropSquare(src)
+	images := make([]AvatarImage, 0, len(AvatarSizes))
+	for _, size := range AvatarSizes {
+		if size > square.Bounds().Dx() {
+			size = square.Bounds().Dx() // Never upscale
+		}
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, resizeSquare(square, size), &jpeg.Options{Quality: avatarJPEGQuality}); err != nil {
+			return nil, err
+		}
+		images = append(images, AvatarImage{Size: size, Data: buf.Bytes()})
+	}
+	return images, nil
+}
+
+// cropSquare copies the centered square of an image onto a white background,
+// which flattens any transparency for JPEG encoding
+func cropSquare(src image.Image) *image.RGBA {
+	bounds := src.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	origin := image.Pt(bounds.Min.X+(bounds.Dx()-side)/2, bounds.Min.Y+(bounds.Dy()-side)/2)
+
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), src, origin, draw.Over)
+	return dst
+}
+
+// resizeSquare scales a square image down to size x size by averaging the
+// source pixels that fall into each destination pixel
+func resizeSquare(src *image.RGBA, size int) *image.RGBA {
+	side := src.Bounds().Dx()
+	if size == side {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		y0, y1 := y*side/size, (y+1)*side/size
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < size; x++ {
+			x0, x1 := x*side/size, (x+1)*side/size
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint32(p[0])
+					g += uint32(p[1])
+					b += uint32(p[2])
+					a += uint32(p[3])
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
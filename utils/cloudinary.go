@@ -2,73 +2,208 @@ package utils
 
 import (
 	"context"
-	"mime/multipart"
-	"os"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/cloudinary/cloudinary-go/v2"
+	"github.com/cloudinary/cloudinary-go/v2/api"
+	"github.com/cloudinary/cloudinary-go/v2/api/admin"
 	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
 )
 
-var cld *cloudinary.Cloudinary
+// CloudinaryStore keeps media in Cloudinary
+type CloudinaryStore struct {
+	cld *cloudinary.Cloudinary
+}
+
+// NewCloudinaryStore creates a Cloudinary backed media store from a CLOUDINARY_URL
+func NewCloudinaryStore(cloudinaryURL string) (*CloudinaryStore, error) {
+	cld, err := cloudinary.NewFromURL(cloudinaryURL)
+	if err != nil {
+		return nil, err
+	}
+	return &CloudinaryStore{cld: cld}, nil
+}
+
+// Upload uploads an asset to Cloudinary
+func (s *CloudinaryStore) Upload(ctx context.Context, r io.Reader, opts UploadOptions) (*UploadResult, error) {
+	uploadResult, err := s.cld.Upload.Upload(ctx, r, uploader.UploadParams{
+		Folder:       opts.Folder,
+		ResourceType: opts.ResourceType,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if uploadResult.Error.Message != "" {
+		return nil, errors.New(uploadResult.Error.Message)
+	}
 
-// InitCloudinary initializes the Cloudinary client
-func InitCloudinary() error {
-	var err error
-	cld, err = cloudinary.NewFromURL(os.Getenv("CLOUDINARY_URL"))
+	return &UploadResult{
+		URL:          uploadResult.SecureURL,
+		PublicID:     uploadResult.PublicID,
+		ResourceType: uploadResult.ResourceType,
+		Width:        uploadResult.Width,
+		Height:       uploadResult.Height,
+	}, nil
+}
+
+// Delete deletes an asset from Cloudinary by its exact public ID
+func (s *CloudinaryStore) Delete(ctx context.Context, publicID string, resourceType string) error {
+	if resourceType == "" {
+		resourceType = "image"
+	}
+
+	result, err := s.cld.Upload.Destroy(ctx, uploader.DestroyParams{
+		PublicID:     publicID,
+		ResourceType: resourceType,
+	})
 	if err != nil {
 		return err
 	}
+	// Cloudinary reports API failures in the result rather than as an error
+	if result.Error.Message != "" {
+		return errors.New(result.Error.Message)
+	}
+	if result.Result != "ok" && result.Result != "not found" {
+		return fmt.Errorf("unexpected destroy result %q", result.Result)
+	}
 	return nil
 }
 
-// UploadImage uploads an image to Cloudinary and returns the URL
-func UploadImage(file *multipart.FileHeader, folder string) (string, error) {
-	ctx := context.Background()
+// cloudinarySignatureTTL is how long Cloudinary accepts a signed upload after its timestamp
+const cloudinarySignatureTTL = time.Hour
 
-	// Open the file
-	src, err := file.Open()
+// SignUpload returns the signed form fields for a direct upload to Cloudinary's upload API
+func (s *CloudinaryStore) SignUpload(ctx context.Context, publicID string, resourceType string, expiresAt time.Time) (*SignedUpload, error) {
+	now := time.Now()
+	if latest := now.Add(cloudinarySignatureTTL); expiresAt.After(latest) {
+		expiresAt = latest
+	}
+
+	params := url.Values{}
+	params.Set("public_id", publicID)
+	params.Set("timestamp", strconv.FormatInt(now.Unix(), 10))
+	signature, err := api.SignParameters(params, s.cld.Config.Cloud.APISecret)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer src.Close()
 
-	// Upload to Cloudinary
-	uploadResult, err := cld.Upload.Upload(ctx, src, uploader.UploadParams{
-		Folder: folder,
+	return &SignedUpload{
+		URL:    fmt.Sprintf("https://api.cloudinary.com/v1_1/%s/%s/upload", s.cld.Config.Cloud.CloudName, resourceType),
+		Method: "POST",
+		Fields: map[string]string{
+			"api_key":   s.cld.Config.Cloud.APIKey,
+			"public_id": publicID,
+			"timestamp": params.Get("timestamp"),
+			"signature": signature,
+		},
+		PublicID:  publicID,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// Stat looks up an asset through Cloudinary's Admin API
+func (s *CloudinaryStore) Stat(ctx context.Context, publicID string, resourceType string) (*UploadResult, error) {
+	asset, err := s.cld.Admin.Asset(ctx, admin.AssetParams{
+		AssetType:    api.AssetType(resourceType),
+		DeliveryType: "upload",
+		PublicID:     publicID,
 	})
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if asset.Error.Message != "" {
+		if strings.Contains(strings.ToLower(asset.Error.Message), "not found") {
+			return nil, ErrAssetNotFound
+		}
+		return nil, errors.New(asset.Error.Message)
 	}
 
-	return uploadResult.SecureURL, nil
+	return &UploadResult{
+		URL:          asset.SecureURL,
+		PublicID:     asset.PublicID,
+		ResourceType: asset.ResourceType,
+		Width:        asset.Width,
+		Height:       asset.Height,
+		MimeType:     cloudinaryMimeType(asset.ResourceType, asset.Format),
+		Bytes:        int64(asset.Bytes),
+	}, nil
 }
 
-// DeleteImage deletes an image from Cloudinary
-func DeleteImage(publicID string) error {
-	ctx := context.Background()
-	
-	// Extract the public ID from the URL
-	if strings.Contains(publicID, "/") {
-		publicID = strings.Split(publicID, "/")[1]
+// Open downloads an asset from its delivery URL
+func (s *CloudinaryStore) Open(ctx context.Context, publicID string, resourceType string) (io.ReadCloser, error) {
+	asset, err := s.Stat(ctx, publicID, resourceType)
+	if err != nil {
+		return nil, err
 	}
 
-	_, err := cld.Upload.Destroy(ctx, uploader.DestroyParams{
-		PublicID: publicID,
-	})
-	return err
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, asset.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("downloading %s: %s", publicID, resp.Status)
+	}
+	return resp.Body, nil
 }
 
-// DeleteImagesFromPost deletes all images associated with a post
-func DeleteImagesFromPost(mediaURLs []string) error {
-	var err error
-	for _, url := range mediaURLs {
-		if url != "" {
-			err = DeleteImage(url)
+// cloudinaryMimeType derives a MIME type from the resource type and format Cloudinary reports
+func cloudinaryMimeType(resourceType string, format string) string {
+	if mimeType := mime.TypeByExtension("." + format); mimeType != "" {
+		return strings.SplitN(mimeType, ";", 2)[0]
+	}
+	if format == "jpg" {
+		format = "jpeg"
+	}
+	return resourceType + "/" + format
+}
+
+// List returns the images and videos whose public ID starts with prefix
+func (s *CloudinaryStore) List(ctx context.Context, prefix string) ([]StoredAsset, error) {
+	var assets []StoredAsset
+	for _, assetType := range []api.AssetType{api.Image, api.Video} {
+		nextCursor := ""
+		for {
+			result, err := s.cld.Admin.Assets(ctx, admin.AssetsParams{
+				AssetType:    assetType,
+				DeliveryType: "upload",
+				Prefix:       prefix,
+				MaxResults:   500,
+				NextCursor:   nextCursor,
+			})
 			if err != nil {
-				return err
+				return nil, err
+			}
+			if result.Error.Message != "" {
+				return nil, errors.New(result.Error.Message)
 			}
+
+			for _, asset := range result.Assets {
+				assets = append(assets, StoredAsset{
+					PublicID:     asset.PublicID,
+					ResourceType: asset.AssetType,
+					Bytes:        int64(asset.Bytes),
+					CreatedAt:    asset.CreatedAt,
+				})
+			}
+
+			if result.NextCursor == "" {
+				break
+			}
+			nextCursor = result.NextCursor
 		}
 	}
-	return nil
+	return assets, nil
 }
@@ -11,6 +11,7 @@ import (
 	"google.golang.org/api/option"
 )
 
+var firebaseApp *firebase.App
 var firebaseAuth *auth.Client
 
 // InitFirebase initializes Firebase Admin SDK
@@ -46,6 +47,7 @@ func InitFirebase() {
 		log.Fatalf("error getting Auth client: %v\n", err)
 	}
 
+	firebaseApp = app
 	firebaseAuth = auth
 }
 
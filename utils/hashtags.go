@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// MaxHashtagLength is the longest hashtag that is turned into a tag
+const MaxHashtagLength = 50
+
+// hashtagPattern matches #hashtags that are not part of a word, a URL fragment or
+// an HTML entity
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&#/])#([\p{L}\p{N}_]+)`)
+
+// ParseHashtags returns the normalized hashtags of a text, without duplicates and in
+// order of appearance. Hashtags without a letter, such as #1, are not tags.
+func ParseHashtags(text string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, match := range hashtagPattern.FindAllStringSubmatch(text, -1) {
+		tag := NormalizeTag(match[1])
+		if len([]rune(tag)) > MaxHashtagLength || !strings.ContainsFunc(tag, unicode.IsLetter) || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// NormalizeTag turns a hashtag into the tag name it is stored under
+func NormalizeTag(name string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "#"))
+}
@@ -0,0 +1,295 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LocalMediaRoute is the path the local store's files are served under
+const LocalMediaRoute = "/media"
+
+// LocalUploadRoute is the API route accepting signed direct uploads to the local store
+const LocalUploadRoute = "/api/uploads/local"
+
+// LocalStore keeps media on the local filesystem, for development and tests
+type LocalStore struct {
+	Dir       string // Directory the files are written to
+	BaseURL   string // URL prefix the files are served from
+	UploadURL string // URL of LocalUploadRoute that signed uploads are sent to
+	Secret    string // Key used to sign direct uploads
+}
+
+// NewLocalStore creates a filesystem backed media store. The directory defaults to
+// ./uploads and the base URL to the relative LocalMediaRoute.
+func NewLocalStore(dir string, baseURL string) (*LocalStore, error) {
+	if dir == "" {
+		dir = "uploads"
+	}
+	if baseURL == "" {
+		baseURL = LocalMediaRoute
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(absDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &LocalStore{Dir: absDir, BaseURL: strings.TrimSuffix(baseURL, "/"), UploadURL: LocalUploadRoute}, nil
+}
+
+// Upload writes an asset to disk under a random name. The extension follows the
+// sniffed MIME type, never the client's file name, as it decides the type the file
+// is served with.
+func (s *LocalStore) Upload(ctx context.Context, r io.Reader, opts UploadOptions) (*UploadResult, error) {
+	publicID := path.Join(opts.Folder, uuid.New().String()+mediaExtensions[opts.MimeType])
+	filePath, err := s.path(publicID)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return nil, err
+	}
+
+	dst, err := os.Create(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(dst, r); err != nil {
+		dst.Close()
+		os.Remove(filePath)
+		return nil, err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(filePath)
+		return nil, err
+	}
+
+	result := &UploadResult{
+		URL:          s.BaseURL + "/" + publicID,
+		PublicID:     publicID,
+		ResourceType: opts.ResourceType,
+	}
+	if opts.ResourceType == "image" {
+		if f, err := os.Open(filePath); err == nil {
+			if config, _, err := image.DecodeConfig(f); err == nil {
+				result.Width = config.Width
+				result.Height = config.Height
+			}
+			f.Close()
+		}
+	}
+	return result, nil
+}
+
+// Delete removes an asset from disk. Deleting a missing file is not an error.
+func (s *LocalStore) Delete(ctx context.Context, publicID string, resourceType string) error {
+	filePath, err := s.path(publicID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List walks the store's directory for files whose public ID starts with prefix
+func (s *LocalStore) List(ctx context.Context, prefix string) ([]StoredAsset, error) {
+	var assets []StoredAsset
+	err := filepath.WalkDir(s.Dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(s.Dir, filePath)
+		if err != nil {
+			return err
+		}
+		publicID := filepath.ToSlash(rel)
+		if !strings.HasPrefix(publicID, prefix) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		resourceType := "image"
+		if strings.HasPrefix(mime.TypeByExtension(path.Ext(publicID)), "video/") {
+			resourceType = "video"
+		}
+		assets = append(assets, StoredAsset{
+			PublicID:     publicID,
+			ResourceType: resourceType,
+			Bytes:        info.Size(),
+			CreatedAt:    info.ModTime(),
+		})
+		return nil
+	})
+	return assets, err
+}
+
+// SignUpload returns a presigned URL the client PUTs the raw file to
+func (s *LocalStore) SignUpload(ctx context.Context, publicID string, resourceType string, expiresAt time.Time) (*SignedUpload, error) {
+	if _, err := s.path(publicID); err != nil {
+		return nil, err
+	}
+
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	query := url.Values{}
+	query.Set("public_id", publicID)
+	query.Set("expires", expires)
+	query.Set("signature", s.sign(publicID, expires))
+
+	return &SignedUpload{
+		URL:       s.UploadURL + "?" + query.Encode(),
+		Method:    "PUT",
+		PublicID:  publicID,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// VerifyUpload checks the signature and expiry of a presigned upload URL
+func (s *LocalStore) VerifyUpload(publicID string, expires string, signature string) error {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid expiry")
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.sign(publicID, expires))) {
+		return fmt.Errorf("invalid signature")
+	}
+	if time.Now().Unix() > expiresAt {
+		return fmt.Errorf("upload URL has expired")
+	}
+	return nil
+}
+
+// Put writes a presigned upload under its public ID. Like Upload, it appends the
+// extension of the sniffed MIME type, as that decides the type the file is served
+// with. It returns the public ID the file was stored under.
+func (s *LocalStore) Put(publicID string, r io.Reader) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	head = head[:n]
+	publicID += mediaExtensions[http.DetectContentType(head)]
+
+	filePath, err := s.path(publicID)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return "", err
+	}
+
+	dst, err := os.Create(filePath)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, io.MultiReader(bytes.NewReader(head), r)); err != nil {
+		dst.Close()
+		os.Remove(filePath)
+		return "", err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(filePath)
+		return "", err
+	}
+	return publicID, nil
+}
+
+// Stat reads an asset's size, type and image dimensions from disk
+func (s *LocalStore) Stat(ctx context.Context, publicID string, resourceType string) (*UploadResult, error) {
+	filePath, err := s.path(publicID)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil, ErrAssetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+
+	result := &UploadResult{
+		URL:          s.BaseURL + "/" + publicID,
+		PublicID:     publicID,
+		ResourceType: resourceType,
+		MimeType:     http.DetectContentType(head[:n]),
+		Bytes:        info.Size(),
+	}
+	if _, err := f.Seek(0, io.SeekStart); err == nil {
+		if config, _, err := image.DecodeConfig(f); err == nil {
+			result.Width = config.Width
+			result.Height = config.Height
+		}
+	}
+	return result, nil
+}
+
+// Open opens an asset on disk
+func (s *LocalStore) Open(ctx context.Context, publicID string, resourceType string) (io.ReadCloser, error) {
+	filePath, err := s.path(publicID)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil, ErrAssetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// sign computes the HMAC of a presigned upload
+func (s *LocalStore) sign(publicID string, expires string) string {
+	mac := hmac.New(sha256.New, []byte(s.Secret))
+	mac.Write([]byte(publicID + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// path resolves a public ID to a file inside the store's directory
+func (s *LocalStore) path(publicID string) (string, error) {
+	filePath := filepath.Join(s.Dir, filepath.FromSlash(path.Clean("/"+publicID)))
+	if !strings.HasPrefix(filePath, s.Dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid public ID %q", publicID)
+	}
+	return filePath, nil
+}
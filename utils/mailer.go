@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// Mailer sends plain text emails
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+var mailer Mailer
+
+// InitMailer sends emails over SMTP when SMTP_HOST is set. Otherwise emails are
+// only logged, which is enough for local development.
+func InitMailer() {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		mailer = LogMailer{}
+		return
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	mailer = &SMTPMailer{
+		Addr:     net.JoinHostPort(host, port),
+		Host:     host,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+}
+
+// GetMailer returns the configured mailer
+func GetMailer() Mailer {
+	if mailer == nil {
+		return LogMailer{}
+	}
+	return mailer
+}
+
+// SMTPMailer sends emails through an SMTP server
+type SMTPMailer struct {
+	Addr     string // host:port of the server
+	Host     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	// Header values must not be able to inject further headers
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("invalid email header")
+	}
+
+	// From may carry a display name, the envelope only takes the address
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %v", err)
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	message := "From: " + m.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + body
+	return smtp.SendMail(m.Addr, auth, from.Address, []string{to}, []byte(message))
+}
+
+// LogMailer writes emails to the log instead of sending them
+type LogMailer struct{}
+
+func (LogMailer) Send(to, subject, body string) error {
+	log.Printf("Email to %s: %s\n%s", to, subject, body)
+	return nil
+}
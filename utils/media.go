@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+const (
+	MaxImageSize = 10 << 20  // 10 MB
+	MaxVideoSize = 100 << 20 // 100 MB
+)
+
+// allowedMediaTypes maps the accepted MIME types to their media type
+var allowedMediaTypes = map[string]string{
+	"image/jpeg": "image",
+	"image/png":  "image",
+	"image/gif":  "image",
+	"image/webp": "image",
+	"video/mp4":  "video",
+	"video/webm": "video",
+}
+
+// mediaExtensions are the extensions stored files get for each accepted MIME type
+var mediaExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"video/mp4":  ".mp4",
+	"video/webm": ".webm",
+}
+
+// MediaInfo describes an uploaded file after validation
+type MediaInfo struct {
+	Type     string // 'image' or 'video'
+	MimeType string
+	Size     int64
+	Width    int
+	Height   int
+}
+
+// InspectMedia validates an uploaded file's type and size. The MIME type is
+// sniffed from the file contents rather than trusted from the client.
+func InspectMedia(file *multipart.FileHeader) (*MediaInfo, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	mimeType := http.DetectContentType(head)
+	mediaType, err := CheckMedia(mimeType, file.Size)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file.Filename, err)
+	}
+
+	info := &MediaInfo{
+		Type:     mediaType,
+		MimeType: mimeType,
+		Size:     file.Size,
+	}
+
+	// Read image dimensions from the header; storage backends may fill them in otherwise
+	if mediaType == "image" {
+		if config, _, err := image.DecodeConfig(io.MultiReader(bytes.NewReader(head), src)); err == nil {
+			info.Width = config.Width
+			info.Height = config.Height
+		}
+	}
+
+	return info, nil
+}
+
+// CheckMedia validates a file's MIME type and size and returns its media type
+func CheckMedia(mimeType string, size int64) (string, error) {
+	mediaType, ok := allowedMediaTypes[mimeType]
+	if !ok {
+		return "", fmt.Errorf("unsupported file type %s", mimeType)
+	}
+
+	maxSize := int64(MaxImageSize)
+	if mediaType == "video" {
+		maxSize = MaxVideoSize
+	}
+	if size > maxSize {
+		return "", fmt.Errorf("file exceeds the %d MB limit for %ss", maxSize>>20, mediaType)
+	}
+	return mediaType, nil
+}
@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MediaStore stores uploaded images and videos
+type MediaStore interface {
+	// Upload stores the contents of r and returns where the asset can be reached
+	Upload(ctx context.Context, r io.Reader, opts UploadOptions) (*UploadResult, error)
+	// Delete removes an asset by the public ID returned from Upload. Deleting an
+	// asset that does not exist is not an error.
+	Delete(ctx context.Context, publicID string, resourceType string) error
+	// List returns every stored asset whose public ID starts with prefix
+	List(ctx context.Context, prefix string) ([]StoredAsset, error)
+	// SignUpload lets a client upload a file straight to storage under the given public ID
+	SignUpload(ctx context.Context, publicID string, resourceType string, expiresAt time.Time) (*SignedUpload, error)
+	// Stat looks up an asset by public ID, returning ErrAssetNotFound if it does not exist
+	Stat(ctx context.Context, publicID string, resourceType string) (*UploadResult, error)
+	// Open reads back the contents of a stored asset
+	Open(ctx context.Context, publicID string, resourceType string) (io.ReadCloser, error)
+}
+
+// ErrAssetNotFound is returned by Stat for assets that are not in storage
+var ErrAssetNotFound = errors.New("asset not found")
+
+// SignedUpload tells a client how to upload a file straight to media storage
+type SignedUpload struct {
+	URL       string            `json:"url"`
+	Method    string            `json:"method"`
+	Fields    map[string]string `json:"fields,omitempty"` // Form fields to send along with the file
+	PublicID  string            `json:"publicId"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+// UploadOptions describes where and how an asset is stored
+type UploadOptions struct {
+	Folder       string
+	ResourceType string // 'image' or 'video'
+	MimeType     string // Sniffed MIME type, used for the stored file's extension
+}
+
+// UploadResult describes a stored asset
+type UploadResult struct {
+	URL          string
+	PublicID     string
+	ResourceType string
+	Width        int
+	Height       int
+	MimeType     string // Only set by Stat
+	Bytes        int64  // Only set by Stat
+	Flagged      bool   // Set when the media scanner flagged the file for review
+	FlagReason   string
+}
+
+// StoredAsset describes an asset found in the media store
+type StoredAsset struct {
+	PublicID     string
+	ResourceType string
+	Bytes        int64
+	CreatedAt    time.Time
+}
+
+var mediaStore MediaStore
+
+// InitMediaStore sets up the media store selected by MEDIA_STORE ("cloudinary" or
+// "local"). When unset, Cloudinary is used if CLOUDINARY_URL is configured and the
+// local filesystem otherwise.
+func InitMediaStore() error {
+	backend := strings.ToLower(os.Getenv("MEDIA_STORE"))
+	if backend == "" {
+		backend = "local"
+		if os.Getenv("CLOUDINARY_URL") != "" {
+			backend = "cloudinary"
+		}
+	}
+
+	switch backend {
+	case "cloudinary":
+		store, err := NewCloudinaryStore(os.Getenv("CLOUDINARY_URL"))
+		if err != nil {
+			return err
+		}
+		mediaStore = store
+	case "local":
+		store, err := NewLocalStore(os.Getenv("MEDIA_LOCAL_DIR"), os.Getenv("MEDIA_BASE_URL"))
+		if err != nil {
+			return err
+		}
+		if uploadURL := os.Getenv("MEDIA_UPLOAD_URL"); uploadURL != "" {
+			store.UploadURL = uploadURL
+		}
+		// Signed upload URLs must not be forgeable by whoever holds another key
+		store.Secret = os.Getenv("MEDIA_SIGNING_SECRET")
+		if store.Secret == "" {
+			return errors.New("MEDIA_SIGNING_SECRET is required for the local media store")
+		}
+		if store.Secret == os.Getenv("JWT_SECRET") {
+			return errors.New("MEDIA_SIGNING_SECRET must differ from JWT_SECRET")
+		}
+		mediaStore = store
+	default:
+		return fmt.Errorf("unknown media store %q", backend)
+	}
+	return nil
+}
+
+// GetMediaStore returns the configured media store
+func GetMediaStore() MediaStore {
+	return mediaStore
+}
+
+// UploadMedia scans an image or video from a multipart form and uploads it.
+// Files rejected by the media scanner return an error wrapping ErrMediaRejected.
+func UploadMedia(file *multipart.FileHeader, info *MediaInfo, folder string) (*UploadResult, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	ctx := context.Background()
+	scan, err := mediaScanner.Scan(ctx, src, info)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := mediaStore.Upload(ctx, scan.Body, UploadOptions{
+		Folder:       folder,
+		ResourceType: info.Type,
+		MimeType:     info.MimeType,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Flagged = scan.Flagged
+	result.FlagReason = scan.Reason
+	return result, nil
+}
+
+// DeleteMedia deletes an asset by its exact public ID
+func DeleteMedia(publicID string, resourceType string) error {
+	return mediaStore.Delete(context.Background(), publicID, resourceType)
+}
+
+// cloudinaryURLPattern captures the resource type and public ID of a Cloudinary delivery URL,
+// e.g. https://res.cloudinary.com/<cloud>/image/upload/v1712345678/posts/abc123.jpg
+var cloudinaryURLPattern = regexp.MustCompile(`/(image|video|raw)/upload/(?:[^/]*,[^/]*/)*(?:v\d+/)?(.+?)(?:\.[^./]+)?$`)
+
+// PublicIDFromURL derives the public ID and resource type of an asset from its
+// Cloudinary URL. It is only needed for media stored before public IDs were recorded.
+func PublicIDFromURL(mediaURL string) (publicID string, resourceType string, ok bool) {
+	parsed, err := url.Parse(mediaURL)
+	if err != nil {
+		return "", "", false
+	}
+	match := cloudinaryURLPattern.FindStringSubmatch(parsed.Path)
+	if match == nil {
+		return "", "", false
+	}
+	return match[2], match[1], true
+}
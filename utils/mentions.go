@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"regexp"
+	"unicode/utf8"
+)
+
+// mentionPattern matches @handles that are not part of a word or an email address.
+// Handles longer than a username can be are not matched at all.
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_@.])@([A-Za-z0-9_]{3,30})(?:[^A-Za-z0-9_@]|$)`)
+
+// MentionMatch is an @handle found in a text. Start and End are character
+// offsets of the handle including its @, End being exclusive.
+type MentionMatch struct {
+	Username string
+	Start    int
+	End      int
+}
+
+// ParseMentions finds the @handles in a text, in order of appearance
+func ParseMentions(text string) []MentionMatch {
+	var matches []MentionMatch
+	offset := 0
+	for offset < len(text) {
+		loc := mentionPattern.FindStringSubmatchIndex(text[offset:])
+		if loc == nil {
+			break
+		}
+		start, end := offset+loc[2]-1, offset+loc[3]
+		matches = append(matches, MentionMatch{
+			Username: text[start+1 : end],
+			Start:    utf8.RuneCountInString(text[:start]),
+			End:      utf8.RuneCountInString(text[:end]),
+		})
+		// The character after a handle may start the next one, e.g. "@ann,@bob"
+		offset = end
+	}
+	return matches
+}
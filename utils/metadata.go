@@ -0,0 +1,435 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// stripImageMetadata removes metadata such as EXIF, GPS, XMP and comments from an
+// image without re-encoding it, and returns the removed parts along with it. Images
+// with other data appended to them, which can make a file valid in a second format
+// as well, are rejected.
+func stripImageMetadata(data []byte, mimeType string) ([]byte, [][]byte, error) {
+	switch mimeType {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		return stripPNG(data)
+	case "image/gif":
+		return stripGIF(data)
+	case "image/webp":
+		return stripWebP(data)
+	}
+	return data, nil, nil
+}
+
+// onlyPadding reports whether b holds nothing but zero bytes
+func onlyPadding(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// stripJPEG drops APPn segments other than JFIF, ICC profiles and Adobe color info,
+// as well as comments. The EXIF orientation is kept so photos still display upright.
+func stripJPEG(data []byte) ([]byte, [][]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, nil, rejectMedia("malformed JPEG")
+	}
+
+	var kept, removed [][]byte
+	orientation := 0
+	pos := 2
+	for {
+		if pos+1 >= len(data) || data[pos] != 0xFF {
+			return nil, nil, rejectMedia("malformed JPEG")
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			pos++ // Fill byte
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			break // Start of scan, the header is done
+		}
+		if pos+4 > len(data) {
+			return nil, nil, rejectMedia("malformed JPEG")
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, nil, rejectMedia("malformed JPEG")
+		}
+
+		payload := data[pos+4 : end]
+		if keepJPEGSegment(marker, payload) {
+			kept = append(kept, data[pos:end])
+		} else {
+			removed = append(removed, payload)
+			if marker == 0xE1 && bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+				orientation = exifOrientation(payload[6:])
+			}
+		}
+		pos = end
+	}
+
+	eoi, err := jpegEnd(data, pos)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Multi-picture JPEGs from phones append further JPEGs, which are dropped
+	trailing := data[eoi:]
+	if !bytes.HasPrefix(trailing, []byte{0xFF, 0xD8}) && !onlyPadding(trailing) {
+		return nil, nil, rejectMedia("image has data appended after its end")
+	}
+	if len(trailing) > 0 {
+		removed = append(removed, trailing)
+	}
+
+	var out bytes.Buffer
+	out.Write(data[:2])
+	if len(kept) > 0 && kept[0][1] == 0xE0 {
+		out.Write(kept[0]) // JFIF must directly follow the start of image
+		kept = kept[1:]
+	}
+	if orientation > 1 {
+		out.Write(orientationSegment(orientation))
+	}
+	for _, segment := range kept {
+		out.Write(segment)
+	}
+	out.Write(data[pos:eoi])
+	return out.Bytes(), removed, nil
+}
+
+// keepJPEGSegment reports whether a JPEG header segment is needed to display the image
+func keepJPEGSegment(marker byte, payload []byte) bool {
+	switch {
+	case marker == 0xE0:
+		return bytes.HasPrefix(payload, []byte("JFIF\x00"))
+	case marker == 0xE2:
+		return bytes.HasPrefix(payload, []byte("ICC_PROFILE\x00"))
+	case marker == 0xEE:
+		return bytes.HasPrefix(payload, []byte("Adobe"))
+	case marker >= 0xE0 && marker <= 0xEF, marker == 0xFE:
+		return false
+	}
+	return true
+}
+
+// jpegEnd returns the offset just past the end of image marker, scanning the
+// entropy-coded data and any segments between progressive scans from pos
+func jpegEnd(data []byte, pos int) (int, error) {
+	for pos+1 < len(data) {
+		if data[pos] != 0xFF {
+			pos++
+			continue
+		}
+		marker := data[pos+1]
+		switch {
+		case marker == 0xD9:
+			return pos + 2, nil
+		case marker == 0x00, marker >= 0xD0 && marker <= 0xD7:
+			pos += 2 // Stuffed byte or restart marker
+		case marker == 0xFF:
+			pos++
+		default:
+			if pos+4 > len(data) {
+				return 0, rejectMedia("malformed JPEG")
+			}
+			pos += 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		}
+	}
+	return 0, rejectMedia("JPEG is truncated")
+}
+
+// exifOrientation reads the orientation tag from the first IFD of EXIF data
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if value := int(order.Uint16(tiff[entry+8:])); value >= 1 && value <= 8 {
+				return value
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// orientationSegment builds an APP1 segment holding nothing but an EXIF orientation
+func orientationSegment(orientation int) []byte {
+	var payload bytes.Buffer
+	payload.WriteString("Exif\x00\x00MM")
+	binary.Write(&payload, binary.BigEndian, uint16(0x2A)) // TIFF magic
+	binary.Write(&payload, binary.BigEndian, uint32(8))    // Offset of the first IFD
+	binary.Write(&payload, binary.BigEndian, uint16(1))    // Number of entries
+	binary.Write(&payload, binary.BigEndian, uint16(0x0112))
+	binary.Write(&payload, binary.BigEndian, uint16(3)) // SHORT
+	binary.Write(&payload, binary.BigEndian, uint32(1))
+	binary.Write(&payload, binary.BigEndian, uint16(orientation))
+	binary.Write(&payload, binary.BigEndian, uint16(0))
+	binary.Write(&payload, binary.BigEndian, uint32(0)) // No next IFD
+
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(payload.Len()+2))
+	return append(segment, payload.Bytes()...)
+}
+
+// pngMetadataChunks are the PNG chunks carrying text, EXIF or timestamps
+var pngMetadataChunks = map[string]bool{
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"eXIf": true,
+	"tIME": true,
+}
+
+// stripPNG drops metadata chunks from a PNG
+func stripPNG(data []byte) ([]byte, [][]byte, error) {
+	const signatureLength = 8
+	if len(data) < signatureLength {
+		return nil, nil, rejectMedia("malformed PNG")
+	}
+
+	var removed [][]byte
+	var out bytes.Buffer
+	out.Write(data[:signatureLength])
+	pos := signatureLength
+	for {
+		if pos+8 > len(data) {
+			return nil, nil, rejectMedia("PNG is truncated")
+		}
+		length := int64(binary.BigEndian.Uint32(data[pos:]))
+		chunkType := string(data[pos+4 : pos+8])
+		end := int64(pos) + 12 + length
+		if end > int64(len(data)) {
+			return nil, nil, rejectMedia("PNG is truncated")
+		}
+		if pngMetadataChunks[chunkType] {
+			removed = append(removed, data[pos+8:end-4])
+		} else {
+			out.Write(data[pos:end])
+		}
+		pos = int(end)
+		if chunkType == "IEND" {
+			break
+		}
+	}
+
+	if !onlyPadding(data[pos:]) {
+		return nil, nil, rejectMedia("image has data appended after its end")
+	}
+	return out.Bytes(), removed, nil
+}
+
+// stripGIF drops comments and application extensions other than animation loop settings
+func stripGIF(data []byte) ([]byte, [][]byte, error) {
+	if len(data) < 13 {
+		return nil, nil, rejectMedia("malformed GIF")
+	}
+
+	pos := 13 // Header and logical screen descriptor
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << ((flags & 0x07) + 1) // Global color table
+	}
+	if pos > len(data) {
+		return nil, nil, rejectMedia("malformed GIF")
+	}
+
+	var removed [][]byte
+	var out bytes.Buffer
+	out.Write(data[:pos])
+	for {
+		if pos >= len(data) {
+			return nil, nil, rejectMedia("GIF is truncated")
+		}
+		switch data[pos] {
+		case 0x21: // Extension
+			if pos+2 > len(data) {
+				return nil, nil, rejectMedia("GIF is truncated")
+			}
+			end, err := skipGIFSubBlocks(data, pos+2)
+			if err != nil {
+				return nil, nil, err
+			}
+			keep := true
+			switch data[pos+1] {
+			case 0xFE: // Comment
+				keep = false
+			case 0xFF: // Application
+				id := data[pos+2 : end]
+				keep = bytes.HasPrefix(id, []byte("\x0bNETSCAPE2.0")) || bytes.HasPrefix(id, []byte("\x0bANIMEXTS1.0"))
+			}
+			if keep {
+				out.Write(data[pos:end])
+			} else {
+				removed = append(removed, data[pos+2:end])
+			}
+			pos = end
+		case 0x2C: // Image descriptor
+			if pos+10 > len(data) {
+				return nil, nil, rejectMedia("GIF is truncated")
+			}
+			start := pos + 10
+			if flags := data[pos+9]; flags&0x80 != 0 {
+				start += 3 << ((flags & 0x07) + 1) // Local color table
+			}
+			end, err := skipGIFSubBlocks(data, start+1) // After the LZW minimum code size
+			if err != nil {
+				return nil, nil, err
+			}
+			out.Write(data[pos:end])
+			pos = end
+		case 0x3B: // Trailer
+			if !onlyPadding(data[pos+1:]) {
+				return nil, nil, rejectMedia("image has data appended after its end")
+			}
+			out.WriteByte(0x3B)
+			return out.Bytes(), removed, nil
+		default:
+			return nil, nil, rejectMedia("malformed GIF")
+		}
+	}
+}
+
+// skipGIFSubBlocks returns the offset just past the data sub-blocks starting at pos
+func skipGIFSubBlocks(data []byte, pos int) (int, error) {
+	for {
+		if pos >= len(data) {
+			return 0, rejectMedia("GIF is truncated")
+		}
+		size := int(data[pos])
+		pos++
+		if size == 0 {
+			return pos, nil
+		}
+		pos += size
+	}
+}
+
+// webpChunk is a chunk inside a WebP RIFF container
+type webpChunk struct {
+	FourCC  string
+	Payload []byte
+}
+
+// parseWebP splits a WebP file into its chunks
+func parseWebP(data []byte) ([]webpChunk, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, rejectMedia("malformed WebP")
+	}
+	end := 8 + int64(binary.LittleEndian.Uint32(data[4:8]))
+	if end > int64(len(data)) {
+		return nil, rejectMedia("WebP is truncated")
+	}
+	if !onlyPadding(data[end:]) {
+		return nil, rejectMedia("image has data appended after its end")
+	}
+
+	var chunks []webpChunk
+	pos := int64(12)
+	for pos < end {
+		if pos+8 > end {
+			return nil, rejectMedia("malformed WebP")
+		}
+		size := int64(binary.LittleEndian.Uint32(data[pos+4:]))
+		if pos+8+size > end {
+			return nil, rejectMedia("WebP is truncated")
+		}
+		chunks = append(chunks, webpChunk{FourCC: string(data[pos : pos+4]), Payload: data[pos+8 : pos+8+size]})
+		pos += 8 + size + size&1 // Chunks are padded to an even size
+	}
+	return chunks, nil
+}
+
+// stripWebP drops EXIF and XMP chunks from a WebP
+func stripWebP(data []byte) ([]byte, [][]byte, error) {
+	chunks, err := parseWebP(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var removed [][]byte
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	for _, chunk := range chunks {
+		payload := chunk.Payload
+		switch chunk.FourCC {
+		case "EXIF", "XMP ":
+			removed = append(removed, payload)
+			continue
+		case "VP8X":
+			if len(payload) > 0 {
+				payload = append([]byte{payload[0] &^ 0x0C}, payload[1:]...) // Clear the EXIF and XMP flags
+			}
+		}
+		body.WriteString(chunk.FourCC)
+		binary.Write(&body, binary.LittleEndian, uint32(len(payload)))
+		body.Write(payload)
+		if len(payload)%2 == 1 {
+			body.WriteByte(0)
+		}
+	}
+
+	var out bytes.Buffer
+	out.WriteString("RIFF")
+	binary.Write(&out, binary.LittleEndian, uint32(body.Len()))
+	out.Write(body.Bytes())
+	return out.Bytes(), removed, nil
+}
+
+// webpDimensions reads the canvas size of a WebP, as the standard library cannot decode it
+func webpDimensions(data []byte) (int, int, error) {
+	chunks, err := parseWebP(data)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, chunk := range chunks {
+		p := chunk.Payload
+		switch chunk.FourCC {
+		case "VP8X":
+			if len(p) >= 10 {
+				width := int(p[4]) | int(p[5])<<8 | int(p[6])<<16
+				height := int(p[7]) | int(p[8])<<8 | int(p[9])<<16
+				return width + 1, height + 1, nil
+			}
+		case "VP8 ":
+			if len(p) >= 10 && p[3] == 0x9D && p[4] == 0x01 && p[5] == 0x2A {
+				width := int(binary.LittleEndian.Uint16(p[6:])) & 0x3FFF
+				height := int(binary.LittleEndian.Uint16(p[8:])) & 0x3FFF
+				return width, height, nil
+			}
+		case "VP8L":
+			if len(p) >= 5 && p[0] == 0x2F {
+				bits := binary.LittleEndian.Uint32(p[1:])
+				return int(bits&0x3FFF) + 1, int(bits>>14&0x3FFF) + 1, nil
+			}
+		}
+	}
+	return 0, 0, rejectMedia("malformed WebP")
+}
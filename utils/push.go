@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"firebase.google.com/go/v4/messaging"
+)
+
+// fcmMulticastLimit is the most tokens FCM accepts in one multicast message
+const fcmMulticastLimit = 500
+
+// PushMessage is a notification shown on a user's devices
+type PushMessage struct {
+	Title       string
+	Body        string
+	Data        map[string]string // Handed to the app, e.g. to open the right screen
+	CollapseKey string            // Pushes with the same key replace each other on the device
+}
+
+// PushSender delivers push messages to device tokens
+type PushSender interface {
+	// Send pushes the message to the tokens and returns the tokens the provider
+	// reported as no longer valid. It only fails when no device could be reached.
+	Send(ctx context.Context, tokens []string, message PushMessage) (invalidTokens []string, err error)
+}
+
+var pushSender PushSender
+
+// InitPushSender sends pushes through Firebase Cloud Messaging when PUSH_PROVIDER
+// is "fcm". Otherwise pushes are only logged, which is enough for local
+// development. Firebase must be initialized first.
+func InitPushSender() {
+	if os.Getenv("PUSH_PROVIDER") != "fcm" {
+		pushSender = FakePushSender{}
+		return
+	}
+
+	client, err := firebaseApp.Messaging(context.Background())
+	if err != nil {
+		log.Fatalf("error getting Messaging client: %v\n", err)
+	}
+	pushSender = &FCMSender{client: client}
+}
+
+// GetPushSender returns the configured push sender
+func GetPushSender() PushSender {
+	if pushSender == nil {
+		return FakePushSender{}
+	}
+	return pushSender
+}
+
+// FCMSender pushes messages through Firebase Cloud Messaging
+type FCMSender struct {
+	client *messaging.Client
+}
+
+func (s *FCMSender) Send(ctx context.Context, tokens []string, message PushMessage) ([]string, error) {
+	var invalidTokens []string
+	var lastErr error
+	delivered := 0
+	for start := 0; start < len(tokens); start += fcmMulticastLimit {
+		batch := tokens[start:min(start+fcmMulticastLimit, len(tokens))]
+		response, err := s.client.SendEachForMulticast(ctx, &messaging.MulticastMessage{
+			Tokens:       batch,
+			Data:         message.Data,
+			Notification: &messaging.Notification{Title: message.Title, Body: message.Body},
+			Android: &messaging.AndroidConfig{
+				CollapseKey:  message.CollapseKey,
+				Notification: &messaging.AndroidNotification{Tag: message.CollapseKey},
+			},
+			APNS: &messaging.APNSConfig{
+				Headers: map[string]string{"apns-collapse-id": message.CollapseKey},
+			},
+		})
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		for i, result := range response.Responses {
+			switch {
+			case result.Success:
+				delivered++
+			case messaging.IsUnregistered(result.Error) || messaging.IsSenderIDMismatch(result.Error):
+				// The app was uninstalled, or the token belongs to another project
+				invalidTokens = append(invalidTokens, batch[i])
+			default:
+				lastErr = result.Error
+			}
+		}
+	}
+
+	if delivered == 0 && lastErr != nil {
+		return invalidTokens, fmt.Errorf("push failed: %v", lastErr)
+	}
+	if lastErr != nil {
+		log.Printf("Push reached %d of %d devices: %v", delivered, len(tokens), lastErr)
+	}
+	return invalidTokens, nil
+}
+
+// FakePushSender writes pushes to the log instead of sending them. Tokens starting
+// with "invalid" are reported as invalid, so pruning can be tried out locally.
+type FakePushSender struct{}
+
+func (FakePushSender) Send(ctx context.Context, tokens []string, message PushMessage) ([]string, error) {
+	var invalidTokens []string
+	for _, token := range tokens {
+		if strings.HasPrefix(token, "invalid") {
+			invalidTokens = append(invalidTokens, token)
+			continue
+		}
+		log.Printf("Push to %s: %s %s %v", token, message.Title, message.Body, message.Data)
+	}
+	return invalidTokens, nil
+}
@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+)
+
+// ErrMediaRejected is wrapped by scanners for files that must not be stored
+var ErrMediaRejected = errors.New("media rejected")
+
+// MediaScanner checks uploaded files before they are stored
+type MediaScanner interface {
+	// Scan inspects a file and returns the contents to store, which may have been
+	// rewritten, e.g. to strip metadata. Files that must not be stored at all return
+	// an error wrapping ErrMediaRejected; files a moderator should review are flagged.
+	Scan(ctx context.Context, r io.Reader, info *MediaInfo) (*ScanResult, error)
+}
+
+// ScanResult is the outcome of a media scan
+type ScanResult struct {
+	Body     io.Reader // Contents to store
+	Modified bool      // Whether Body differs from the scanned file
+	Flagged  bool      // Store the file but quarantine it until a moderator reviews it
+	Reason   string    // Why the file was flagged
+}
+
+// rejectMedia returns an error wrapping ErrMediaRejected
+func rejectMedia(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrMediaRejected, fmt.Sprintf(format, args...))
+}
+
+var mediaScanner MediaScanner = NewDefaultScanner()
+
+// GetMediaScanner returns the scanner run on every upload
+func GetMediaScanner() MediaScanner {
+	return mediaScanner
+}
+
+// SetMediaScanner replaces the scanner run on every upload, e.g. with one backed by
+// a content moderation service
+func SetMediaScanner(scanner MediaScanner) {
+	mediaScanner = scanner
+}
+
+const (
+	MaxImageDimension = 10000      // Largest width or height accepted for an image
+	MaxImagePixels    = 50_000_000 // Largest width times height accepted for an image
+)
+
+// DefaultScanner checks that a file's contents match its type, rejects images with
+// oversized dimensions or data appended to them, and strips image metadata such as
+// EXIF and GPS data. Images whose metadata hides markup or scripts are flagged for
+// review.
+type DefaultScanner struct {
+	MaxDimension int
+	MaxPixels    int
+}
+
+// NewDefaultScanner creates a DefaultScanner with the default limits
+func NewDefaultScanner() *DefaultScanner {
+	return &DefaultScanner{MaxDimension: MaxImageDimension, MaxPixels: MaxImagePixels}
+}
+
+// embeddedContentMarkers hint at markup or scripts hidden in an image's metadata.
+// Pixel data is never searched, as compressed data contains them by chance.
+var embeddedContentMarkers = [][]byte{
+	[]byte("<script"),
+	[]byte("<?php"),
+	[]byte("<html"),
+	[]byte("<iframe"),
+	[]byte("<svg"),
+	[]byte("javascript:"),
+}
+
+// Scan implements MediaScanner
+func (s *DefaultScanner) Scan(ctx context.Context, r io.Reader, info *MediaInfo) (*ScanResult, error) {
+	if info.Type == "video" {
+		// Videos are passed through after checking their signature
+		head := make([]byte, 512)
+		n, err := io.ReadFull(r, head)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return nil, err
+		}
+		head = head[:n]
+		if mimeType := http.DetectContentType(head); mimeType != info.MimeType {
+			return nil, rejectMedia("file contents are %s, not %s", mimeType, info.MimeType)
+		}
+		return &ScanResult{Body: io.MultiReader(bytes.NewReader(head), r)}, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, MaxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxImageSize {
+		return nil, rejectMedia("image exceeds the %d MB limit", MaxImageSize>>20)
+	}
+	if mimeType := http.DetectContentType(data); mimeType != info.MimeType {
+		return nil, rejectMedia("file contents are %s, not %s", mimeType, info.MimeType)
+	}
+
+	width, height, err := imageDimensions(data, info.MimeType)
+	if err != nil {
+		return nil, rejectMedia("image could not be read")
+	}
+	if width > s.MaxDimension || height > s.MaxDimension || width*height > s.MaxPixels {
+		return nil, rejectMedia("image dimensions %dx%d are too large", width, height)
+	}
+
+	cleaned, metadata, err := stripImageMetadata(data, info.MimeType)
+	if err != nil {
+		return nil, err
+	}
+	result := &ScanResult{
+		Body:     bytes.NewReader(cleaned),
+		Modified: !bytes.Equal(cleaned, data),
+	}
+
+	// The metadata is not stored, but hiding markup in it suggests the uploader is
+	// up to something a moderator should look at
+	for _, segment := range metadata {
+		if containsEmbeddedContent(segment) {
+			result.Flagged = true
+			result.Reason = "image metadata contains embedded markup or scripts"
+			break
+		}
+	}
+	return result, nil
+}
+
+// containsEmbeddedContent reports whether b contains any embeddedContentMarkers
+func containsEmbeddedContent(b []byte) bool {
+	lower := bytes.ToLower(b)
+	for _, marker := range embeddedContentMarkers {
+		if bytes.Contains(lower, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// imageDimensions reads an image's size from its header
+func imageDimensions(data []byte, mimeType string) (int, int, error) {
+	if mimeType == "image/webp" {
+		return webpDimensions(data)
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+	return config.Width, config.Height, nil
+}